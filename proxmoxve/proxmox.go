@@ -5,14 +5,18 @@ package proxmoxve
 // in https://pve.proxmox.com/pve-docs/api-viewer/apidoc.js
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"reflect"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docker/machine/libmachine/state"
@@ -20,6 +24,17 @@ import (
 	"gopkg.in/resty.v1"
 )
 
+const (
+	ticketLifetime    = 2 * time.Hour          // Proxmox VE tickets are valid for two hours
+	ticketRenewMargin = 1 * time.Minute        // renew the ticket if it expires within this margin
+	retryBaseDelay    = 500 * time.Millisecond // delay before the first retry, doubled for each further one
+)
+
+// DriverVersion is sent in the User-Agent header of all API requests, so Proxmox VE logs tell which
+// driver release made a request. Releases set it with
+// -ldflags "-X github.com/mhermosi/docker-machine-driver-proxmoxve/proxmoxve.DriverVersion=v1.2.3"
+var DriverVersion = "dev"
+
 // ProxmoxVE open api connection representation
 type ProxmoxVE struct {
 	// connection parameters
@@ -29,24 +44,119 @@ type ProxmoxVE struct {
 	Host     string
 	Port     int // default 8006
 
+	// API token authentication, used instead of username/password if given
+	TokenID     string // user@realm!tokenid
+	tokenSecret string // secret UUID of the token
+
 	// not so imported internal stuff
-	Node                string // if not present, use first node present
-	Prefix              string // if PVE is proxied, this is the added prefix
-	CSRFPreventionToken string // filled by the framework
-	Ticket              string // filled by the framework
+	Node                string    // if not present, use first node present
+	Prefix              string    // if PVE is proxied, this is the added prefix
+	CSRFPreventionToken string    // filled by the framework
+	Ticket              string    // filled by the framework
+	TicketExpiry        time.Time // filled by the framework, a valid cached ticket is reused instead of logging in
 
-	Version string // ProxmoxVE version of the connected host
+	Version string // ProxmoxVE version of the connected host, see GetCapabilities
 
-	client *resty.Client // resty client
+	Retries int  // number of retries of GET and other safely repeatable requests on transient failures
+	Debug   bool // log retried requests
+
+	TLSConfig *tls.Config   // optional, certificate verification is skipped if nil
+	client    *resty.Client // resty client
+}
+
+// apiError is returned if the API answered with an unsuccessful status code
+type apiError struct {
+	code   int
+	status string
+	body   string // response body, parameter errors are only detailed there
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("status code was '%d' and error is\n%s", e.code, e.status)
+}
+
+// transient returns true for errors that may go away if the request is repeated,
+// i.e. connection problems and server side errors like 596 of a loaded cluster. Certificate,
+// decoding and context errors stay the same however often the request is repeated.
+func transient(err error) bool {
+	if e, ok := err.(*apiError); ok {
+		return e.code >= 500
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		// "remote error" is a TLS alert of the server, e.g. a rejected client certificate
+		return opErr.Op == "dial" || opErr.Op == "read" || opErr.Op == "write"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// vmidInUse returns true if /cluster/nextid refused a VMID because a VM already uses it,
+// it answers with 400 and an "already exists" parameter error, other 400s are real errors
+func vmidInUse(err error) bool {
+	if e, ok := err.(*apiError); ok {
+		return e.code == http.StatusBadRequest && (strings.Contains(e.body, "already exists") || strings.Contains(e.status, "already exists"))
+	}
+	return false
+}
+
+// agentNotRunning returns true if an agent command failed because the guest agent does not
+// answer yet, Proxmox VE reports that with 500 and "QEMU guest agent is not running"
+func agentNotRunning(err error) bool {
+	if e, ok := err.(*apiError); ok {
+		return e.code == http.StatusInternalServerError && (strings.Contains(e.status, "not running") || strings.Contains(e.body, "not running"))
+	}
+	return false
+}
+
+// vmNotFoundError is returned by FindVMIDByName if no VM has the name
+type vmNotFoundError struct {
+	name string
+	node string
+}
+
+func (e *vmNotFoundError) Error() string {
+	return fmt.Sprintf("no VM named '%s' found on node '%s'", e.name, e.node)
+}
+
+// notFound returns true if the API reported that the requested object does not exist,
+// Proxmox VE answers with 500 and a "does not exist" message for missing VMs
+func notFound(err error) bool {
+	if e, ok := err.(*apiError); ok {
+		return e.code == http.StatusNotFound || strings.Contains(e.status, "does not exist")
+	}
+	return false
 }
 
 // GetProxmoxVEConnectionByValues is a wrapper for GetProxmoxVEConnection with strings as input
 func GetProxmoxVEConnectionByValues(username string, password string, realm string, hostname string) (*ProxmoxVE, error) {
+	return GetProxmoxVEConnectionByValuesWithPort(username, password, realm, hostname, 0)
+}
+
+// GetProxmoxVEConnectionByValuesWithPort is a wrapper for GetProxmoxVEConnection with a non-default port, 0 means default
+func GetProxmoxVEConnectionByValuesWithPort(username string, password string, realm string, hostname string, port int) (*ProxmoxVE, error) {
 	return GetProxmoxVEConnection(&ProxmoxVE{
 		Username: username,
 		password: password,
 		Realm:    realm,
 		Host:     hostname,
+		Port:     port,
+	})
+}
+
+// GetProxmoxVEConnectionByToken is a wrapper for GetProxmoxVEConnection authenticating with an API token, port 0 means default
+func GetProxmoxVEConnectionByToken(tokenID string, tokenSecret string, hostname string, port int) (*ProxmoxVE, error) {
+	return GetProxmoxVEConnection(&ProxmoxVE{
+		TokenID:     tokenID,
+		tokenSecret: tokenSecret,
+		Host:        hostname,
+		Port:        port,
 	})
 }
 
@@ -56,10 +166,104 @@ func GetProxmoxVEConnection(data *ProxmoxVE) (*ProxmoxVE, error) {
 		data.Port = 8006
 	}
 
-	if len(data.password) == 0 {
+	if len(data.TokenID) > 0 {
+		if len(data.tokenSecret) == 0 {
+			return data, fmt.Errorf("You have to provide an API token secret")
+		}
+	} else if len(data.password) == 0 {
 		return data, fmt.Errorf("You have to provide a password")
 	}
 
+	data.client = resty.New()
+	data.client.SetHeader("User-Agent", "docker-machine-driver-proxmoxve/"+DriverVersion)
+
+	//data.client.SetDebug(true)
+	if data.TLSConfig != nil {
+		data.client.SetTLSClientConfig(data.TLSConfig)
+	} else {
+		data.client.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	}
+	//data.client.SetTimeout(time.Duration(3 * time.Second))
+
+	cached := false
+	if len(data.TokenID) > 0 {
+		// API tokens are stateless, no ticket or CSRF token needed
+		data.client.SetHeader("Authorization", fmt.Sprintf("PVEAPIToken=%s=%s", data.TokenID, data.tokenSecret))
+	} else if data.ticketValid(time.Now()) {
+		data.useTicket()
+		cached = true
+	} else if err := data.login(); err != nil {
+		return data, err
+	}
+
+	ver, err := data.versionGet()
+	if err != nil && cached {
+		// the cached ticket may have been revoked, try once more with a fresh one
+		log.Debugf("Cached ticket was rejected, logging in again: %s", err)
+		if err = data.login(); err != nil {
+			return data, err
+		}
+		ver, err = data.versionGet()
+	}
+	if err != nil {
+		return data, err
+	}
+
+	data.Version = ver.Version
+
+	return data, nil
+}
+
+// Capabilities describes the features of the connected host that depend on its version,
+// all of them are off if the version could not be parsed
+type Capabilities struct {
+	Major int // major version, 0 if it could not be parsed
+	Minor int // minor version
+
+	Q35            bool // the q35 machine type with PCIe is available, PCI passthrough needs it
+	CloudInitDrive bool // cloud-init drives are attached as <storage>:cloudinit and named vm-<vmid>-cloudinit
+	CgroupV2       bool // guests run in cgroup v2, cpuunits range from 1 to 10000 instead of 2 to 262144
+	Tags           bool // VMs can be tagged
+	AgentFreezeFs  bool // freezing the file systems by the agent during backups can be turned off with freeze-fs-on-backup
+	SCSISingle     bool // new VMs use virtio-scsi-single, one controller per disk
+	CIUpgrade      bool // cloud-init package upgrade on first boot can be turned off with ciupgrade
+}
+
+// GetCapabilities returns the features supported by the connected host
+func (data *ProxmoxVE) GetCapabilities() Capabilities {
+	major, minor := parseVersion(data.Version)
+	atLeast := func(wantMajor int, wantMinor int) bool {
+		return major > wantMajor || (major == wantMajor && minor >= wantMinor)
+	}
+	return Capabilities{
+		Major:          major,
+		Minor:          minor,
+		Q35:            atLeast(4, 0),
+		CloudInitDrive: atLeast(5, 2),
+		CgroupV2:       atLeast(7, 0),
+		Tags:           atLeast(7, 0),
+		AgentFreezeFs:  atLeast(7, 4),
+		SCSISingle:     atLeast(8, 0),
+		CIUpgrade:      atLeast(8, 1),
+	}
+}
+
+// parseVersion returns major and minor of a version string like 8.1.4 or 6.4-13, 0 for missing parts
+func parseVersion(version string) (int, int) {
+	parts := strings.SplitN(strings.SplitN(version, "-", 2)[0], ".", 3)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0
+	}
+	minor := 0
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+	return major, minor
+}
+
+// login retrieves a ticket with username and password and sets it on the client
+func (data *ProxmoxVE) login() error {
 	if len(data.Username) == 0 {
 		data.Username = "root"
 	}
@@ -67,12 +271,6 @@ func GetProxmoxVEConnection(data *ProxmoxVE) (*ProxmoxVE, error) {
 		data.Realm = "pam"
 	}
 
-	data.client = resty.New()
-
-	//data.client.SetDebug(true)
-	data.client.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
-	//data.client.SetTimeout(time.Duration(3 * time.Second))
-
 	outp, err := data.accessTicketPost(&AccessTicketPostParameter{
 		Username: data.Username,
 		Realm:    data.Realm,
@@ -80,29 +278,36 @@ func GetProxmoxVEConnection(data *ProxmoxVE) (*ProxmoxVE, error) {
 	})
 
 	if err != nil {
-		return data, err
+		return err
 	}
 
 	if outp.Csrfpreventiontoken == "" {
-		return nil, fmt.Errorf("Could not extract CSRFPreventionToken")
+		return fmt.Errorf("Could not extract CSRFPreventionToken")
 	}
 
 	data.CSRFPreventionToken = outp.Csrfpreventiontoken
-	data.client.SetHeader("CSRFPreventionToken", outp.Csrfpreventiontoken)
-	data.client.SetCookie(&http.Cookie{
-		Name:  "PVEAuthCookie",
-		Value: outp.Ticket,
-	})
 	data.Ticket = outp.Ticket
+	data.TicketExpiry = time.Now().Add(ticketLifetime)
+	data.useTicket()
 
-	ver, err := data.versionGet()
-	if err != nil {
-		return data, err
-	}
+	return nil
+}
 
-	data.Version = ver.Version
+// ticketValid returns true if a ticket is present that does not expire within the renew margin
+func (data *ProxmoxVE) ticketValid(now time.Time) bool {
+	if data.Ticket == "" || data.CSRFPreventionToken == "" {
+		return false
+	}
+	return now.Add(ticketRenewMargin).Before(data.TicketExpiry)
+}
 
-	return data, nil
+// useTicket sets the ticket and CSRF token on the client
+func (data *ProxmoxVE) useTicket() {
+	data.client.SetHeader("CSRFPreventionToken", data.CSRFPreventionToken)
+	data.client.SetCookie(&http.Cookie{
+		Name:  "PVEAuthCookie",
+		Value: data.Ticket,
+	})
 }
 
 func (p ProxmoxVE) EnableDebugging() {
@@ -123,8 +328,12 @@ func (p ProxmoxVE) structToStringMap(i interface{}) map[string]string {
 	typ := iVal.Type()
 	for i := 0; i < iVal.NumField(); i++ {
 		f := iVal.Field(i)
-		// You ca use tags here...
-		// tag := typ.Field(i).Tag.Get("tagname")
+		// the API parameter name defaults to the lower case field name
+		// and can be overridden with the `api:"name"` tag
+		name := strings.ToLower(typ.Field(i).Name)
+		if tag := typ.Field(i).Tag.Get("api"); tag != "" {
+			name = tag
+		}
 		// Convert each type into a string for the url.Values string map
 		var v string
 		switch f.Interface().(type) {
@@ -147,14 +356,16 @@ func (p ProxmoxVE) structToStringMap(i interface{}) map[string]string {
 			} else {
 				v = "0"
 			}
+		case map[string]string:
+			// parameters with dynamic names like virtio0 or hostpci1 are passed as is
+			for key, value := range f.Interface().(map[string]string) {
+				retval[key] = value
+			}
 		}
 		if len(v) > 0 {
-			retval[strings.ToLower(typ.Field(i).Name)] = v
+			retval[name] = v
 		}
 	}
-	// MARTINH
-	fmt.Printf("structToStringMap: %s\n\n", retval)
-	fmt.Printf("structToStringMap: %+v\n\n", retval)
 	return retval
 }
 
@@ -162,8 +373,17 @@ func (p ProxmoxVE) post(input interface{}, output interface{}, path string) erro
 	return p.runMethod("post", input, output, path)
 }
 
+// postRetryable is post for requests that have no side effects if repeated
+func (p ProxmoxVE) postRetryable(input interface{}, output interface{}, path string) error {
+	return p.retry("post", path, func() error {
+		return p.runMethod("post", input, output, path)
+	})
+}
+
 func (p ProxmoxVE) get(input interface{}, output interface{}, path string) error {
-	return p.runMethod("get", input, output, path)
+	return p.retry("get", path, func() error {
+		return p.runMethod("get", input, output, path)
+	})
 }
 
 func (p ProxmoxVE) put(input interface{}, output interface{}, path string) error {
@@ -174,31 +394,37 @@ func (p ProxmoxVE) delete(input interface{}, output interface{}, path string) er
 	return p.runMethod("delete", input, output, path)
 }
 
-func (p ProxmoxVE) runMethod(method string, input interface{}, output interface{}, path string) error {
-	var response *resty.Response
-	var err error
-
-	switch method {
-	case "get":
-		response, err = p.client.R().SetQueryParams(p.structToStringMap(input)).Get(p.getURL(path))
-	case "post":
-		response, err = p.client.R().SetFormData(p.structToStringMap(input)).Post(p.getURL(path))
-	case "put":
-		response, err = p.client.R().SetQueryParams(p.structToStringMap(input)).Put(p.getURL(path))
-	case "delete":
-		response, err = p.client.R().SetQueryParams(p.structToStringMap(input)).Delete(p.getURL(path))
-	default:
-		return fmt.Errorf("method '%s' not known", method)
+// retry calls fn until it succeeds, fails permanently or the retries are used up,
+// waiting exponentially longer between the attempts
+func (p ProxmoxVE) retry(method string, path string, fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !transient(err) {
+			return err
+		}
+		if attempt > p.Retries {
+			if p.Retries > 0 {
+				log.Errorf("%s %s failed after %d retries: %s", method, path, p.Retries, err)
+			}
+			return err
+		}
+		log.Warnf("%s %s failed, retry %d of %d in %s: %s", method, path, attempt, p.Retries, delay, err)
+		time.Sleep(delay)
+		delay *= 2
 	}
+}
 
+func (p ProxmoxVE) runMethod(method string, input interface{}, output interface{}, path string) error {
+	return p.runMethodContext(context.Background(), method, input, output, path)
+}
+
+// runMethodContext is runMethod with a context, the request is aborted when ctx is done
+func (p ProxmoxVE) runMethodContext(ctx context.Context, method string, input interface{}, output interface{}, path string) error {
+	response, err := p.request(ctx, method, input, path)
 	if err != nil {
 		return err
 	}
-	code := response.StatusCode()
-	if code < 200 || code > 300 {
-		fmt.Printf("RESPONSE OBJECT:\n\n%+v\n", response)
-		return fmt.Errorf("status code was '%d' and error is\n%s", code, response.Status())
-	}
 
 	if output == nil {
 		return nil
@@ -220,6 +446,52 @@ func (p ProxmoxVE) runMethod(method string, input interface{}, output interface{
 	return err
 }
 
+// request sends a request and returns the response if it succeeded
+func (p ProxmoxVE) request(ctx context.Context, method string, input interface{}, path string) (*resty.Response, error) {
+	var response *resty.Response
+	var err error
+
+	request := p.client.R().SetContext(ctx)
+	switch method {
+	case "get":
+		response, err = request.SetQueryParams(p.structToStringMap(input)).Get(p.getURL(path))
+	case "post":
+		response, err = request.SetFormData(p.structToStringMap(input)).Post(p.getURL(path))
+	case "put":
+		response, err = request.SetQueryParams(p.structToStringMap(input)).Put(p.getURL(path))
+	case "delete":
+		response, err = request.SetQueryParams(p.structToStringMap(input)).Delete(p.getURL(path))
+	default:
+		return nil, fmt.Errorf("method '%s' not known", method)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	code := response.StatusCode()
+	if code < 200 || code > 300 {
+		if p.Debug {
+			log.Debugf("%s %s returned %s: %s", method, path, response.Status(), response.String())
+		}
+		return nil, &apiError{code: code, status: response.Status(), body: response.String()}
+	}
+	return response, nil
+}
+
+// getRaw is get for responses that carry more than the data, it returns the whole body
+func (p ProxmoxVE) getRaw(input interface{}, path string) ([]byte, error) {
+	var body []byte
+	err := p.retry("get", path, func() error {
+		response, err := p.request(context.Background(), "get", input, path)
+		if err != nil {
+			return err
+		}
+		body = response.Body()
+		return nil
+	})
+	return body, err
+}
+
 // AccessTicketPostParameter represents the input data for /access/ticket
 // Original Description:
 // Create or verify authentication ticket.
@@ -246,7 +518,7 @@ type AccessTicketReturnParameter struct {
 func (p ProxmoxVE) accessTicketPost(input *AccessTicketPostParameter) (*AccessTicketReturnParameter, error) {
 	path := "/access/ticket"
 	outp := AccessTicketReturnParameter{}
-	err := p.post(input, &outp, path)
+	err := p.postRetryable(input, &outp, path)
 	return &outp, err
 }
 
@@ -272,18 +544,19 @@ func (p ProxmoxVE) versionGet() (*VersionReturnParameter, error) {
 // Original Description:
 // Allocate disk images.
 type NodesNodeStorageStorageContentPostParameter struct {
-	Filename string // The name of the file to create.
-	Size     string // Size in kilobyte (1024 bytes). Optional suffixes 'M' (megabyte, 1024K) and 'G' (gigabyte, 1024M)
-	VMID     string // Specify owner VM
-	Format   string // optional,
+	Filename      string // The name of the file to create.
+	Size          string // Size in kilobyte (1024 bytes). Optional suffixes 'M' (megabyte, 1024K) and 'G' (gigabyte, 1024M)
+	VMID          string // Specify owner VM
+	Format        string // optional,
+	Preallocation string // optional, Preallocation mode for raw and qcow2 images on file based storages.
 }
 
 // NodesNodeStorageStorageContentPost access the API
-// Allocate disk images.
-func (p ProxmoxVE) NodesNodeStorageStorageContentPost(node string, storage string, input *NodesNodeStorageStorageContentPostParameter) error {
+// Allocate disk images. Returns the volume id of the allocated image. The request is aborted when ctx is done.
+func (p ProxmoxVE) NodesNodeStorageStorageContentPost(ctx context.Context, node string, storage string, input *NodesNodeStorageStorageContentPostParameter) (volid string, err error) {
 	path := fmt.Sprintf("/nodes/%s/storage/%s/content", node, storage)
-	err := p.post(input, nil, path)
-	return err
+	err = p.runMethodContext(ctx, "post", input, &volid, path)
+	return volid, err
 }
 
 
@@ -295,41 +568,305 @@ err := p.delete(nil, nil, path)
 return err
 }
 
+// NodesNodeStorageStorageContentReturnParameter represents the returned data from /nodes/{node}/storage/{storage}/content
+// Original Description:
+// List storage content.
+type NodesNodeStorageStorageContentReturnParameter struct {
+	Volid   string // Volume identifier.
+	Format  string // Format identifier ('raw', 'qcow2', 'subvol', 'iso', 'tgz' ...)
+	Content string // Content type (iso, images, vztmpl, ...)
+	Size    int64  // Volume size in bytes.
+	VMID    int    // optional, associated owner VMID.
+}
+
+// NodesNodeStorageStorageContentGet access the API
+// List storage content. Only volumes of the given content type are returned if content is not empty.
+func (p ProxmoxVE) NodesNodeStorageStorageContentGet(node string, storage string, content string) ([]NodesNodeStorageStorageContentReturnParameter, error) {
+	path := fmt.Sprintf("/nodes/%s/storage/%s/content", node, storage)
+	input := struct{ Content string }{Content: content}
+	outp := []NodesNodeStorageStorageContentReturnParameter{}
+	err := p.get(&input, &outp, path)
+	return outp, err
+}
+
+// NodesNodeStorageStorageStatusReturnParameter represents the returned data from /nodes/{node}/storage/{storage}/status
+// Original Description:
+// Read storage status.
+type NodesNodeStorageStorageStatusReturnParameter struct {
+	Type    string // optional, storage type
+	Content string // optional, allowed storage content types
+	Active  int    // optional, set when storage is accessible
+	Enabled int    // optional, set when storage is enabled (not disabled)
+	Shared  int    // optional, shared flag from storage configuration
+	Total   int64  // optional, total storage space in bytes
+	Used    int64  // optional, used storage space in bytes
+	Avail   int64  // optional, available storage space in bytes
+}
+
+// GetStorageStatus access the API
+// Read storage status.
+func (p ProxmoxVE) GetStorageStatus(node string, storage string) (*NodesNodeStorageStorageStatusReturnParameter, error) {
+	path := fmt.Sprintf("/nodes/%s/storage/%s/status", node, storage)
+	outp := NodesNodeStorageStorageStatusReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return &outp, err
+}
+
+// StorageContentExists reports whether the volume volid is stored on the storage of the node
+func (p ProxmoxVE) StorageContentExists(node string, storage string, volid string) (bool, error) {
+	volumes, err := p.NodesNodeStorageStorageContentGet(node, storage, "")
+	if err != nil {
+		return false, err
+	}
+	for _, v := range volumes {
+		if v.Volid == volid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ClusterNextIDGetParameter represents the input data for /cluster/nextid
+// Original Description:
+// Get next free VMID. Pass a VMID to assert that its free (at time of check).
+type ClusterNextIDGetParameter struct {
+	VMID string // optional, The (unique) ID of the VM.
+}
+
 // ClusterNextIDGet Get next free VMID. If you pass an VMID it will raise an error if the ID is already used.
 func (p ProxmoxVE) ClusterNextIDGet(id int) (vmid string, err error) {
 	path := "/cluster/nextid"
 	if id == 0 {
 		err = p.get(nil, &vmid, path)
 	} else {
-		err = p.get(id, &vmid, path)
+		err = p.get(&ClusterNextIDGetParameter{VMID: strconv.Itoa(id)}, &vmid, path)
 	}
 	return vmid, err
 }
 
+// VMIDExists returns true if a VM or container of the cluster uses the VMID
+func (p ProxmoxVE) VMIDExists(vmid string) (bool, error) {
+	resources, err := p.ClusterResourcesGet("vm")
+	if err != nil {
+		return false, err
+	}
+	for _, resource := range resources {
+		if strconv.Itoa(resource.VMID) == vmid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ClusterResourcesReturnParameter represents the returned data from /cluster/resources
+// Original Description:
+// Resources index (cluster wide).
+type ClusterResourcesReturnParameter struct {
+	ID     string  // resource id, e.g. node/pve
+	Type   string  // resource type (node, storage, pool, qemu, lxc, openvz, sdn)
+	Node   string  // optional, the cluster node name
+	VMID   int     // optional, the VMID of qemu and lxc resources
+	Status string  // optional, resource status, online for available nodes
+	Mem    int64   // optional, used memory in bytes
+	Maxmem int64   // optional, number of available memory in bytes
+	CPU    float64 // optional, CPU utilization
+	Maxcpu float64 // optional, number of available CPUs
+}
+
+// ClusterResourcesGet access the API
+// Resources index (cluster wide). Only resources of the given type are returned if restype is not empty.
+func (p ProxmoxVE) ClusterResourcesGet(restype string) ([]ClusterResourcesReturnParameter, error) {
+	path := "/cluster/resources"
+	input := struct{ Type string }{Type: restype}
+	outp := []ClusterResourcesReturnParameter{}
+	err := p.get(&input, &outp, path)
+	return outp, err
+}
+
+// PoolsReturnParameter represents the returned data from /pools
+// Original Description:
+// Pool index.
+type PoolsReturnParameter struct {
+	Poolid  string
+	Comment string // optional
+}
+
+// PoolsGet access the API
+// Pool index.
+func (p ProxmoxVE) PoolsGet() ([]PoolsReturnParameter, error) {
+	path := "/pools"
+	outp := []PoolsReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return outp, err
+}
+
+// ClusterHAGroupsReturnParameter represents the returned data from /cluster/ha/groups
+// Original Description:
+// Get HA groups.
+type ClusterHAGroupsReturnParameter struct {
+	Group   string // The HA group identifier.
+	Nodes   string // optional, List of cluster node names with optional priority.
+	Comment string // optional
+}
+
+// ClusterHAGroupsGet access the API
+// Get HA groups.
+func (p ProxmoxVE) ClusterHAGroupsGet() ([]ClusterHAGroupsReturnParameter, error) {
+	path := "/cluster/ha/groups"
+	outp := []ClusterHAGroupsReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return outp, err
+}
+
+// ClusterHAResourcesPostParameter represents the input data for /cluster/ha/resources
+// Original Description:
+// Create a new HA resource.
+type ClusterHAResourcesPostParameter struct {
+	Sid     string // HA resource ID. This consists of a resource type followed by a resource specific name, separated with colon (example: vm:100 / ct:100).
+	Group   string // optional, The HA group identifier.
+	State   string // optional, Requested resource state (started, stopped, enabled, disabled, ignored).
+	Comment string // optional, Description.
+}
+
+// ClusterHAResourcesPost access the API
+// Create a new HA resource.
+func (p ProxmoxVE) ClusterHAResourcesPost(input *ClusterHAResourcesPostParameter) error {
+	path := "/cluster/ha/resources"
+	err := p.post(input, nil, path)
+	return err
+}
+
+// ClusterHAResourcesSIDDelete access the API
+// Delete resource configuration.
+func (p ProxmoxVE) ClusterHAResourcesSIDDelete(sid string) error {
+	path := fmt.Sprintf("/cluster/ha/resources/%s", sid)
+	err := p.delete(nil, nil, path)
+	return err
+}
+
+// ClusterSdnIpamsIpamStatusReturnParameter represents the returned data from /cluster/sdn/ipams/{ipam}/status
+// Original Description:
+// List PVE IPAM Entries
+type ClusterSdnIpamsIpamStatusReturnParameter struct {
+	Mac    string // optional, MAC address the IP is leased to.
+	IP     string // IP address.
+	Subnet string // optional
+	Vnet   string // optional
+	Zone   string // optional
+}
+
+// ClusterSdnIpamsIpamStatusGet access the API
+// List PVE IPAM Entries
+func (p ProxmoxVE) ClusterSdnIpamsIpamStatusGet(ipam string) ([]ClusterSdnIpamsIpamStatusReturnParameter, error) {
+	path := fmt.Sprintf("/cluster/sdn/ipams/%s/status", ipam)
+	outp := []ClusterSdnIpamsIpamStatusReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return outp, err
+}
+
+// ClusterSdnVnetsVnetReturnParameter represents the returned data from /cluster/sdn/vnets/{vnet}
+type ClusterSdnVnetsVnetReturnParameter struct {
+	Vnet string // The SDN vnet object identifier.
+	Zone string // zone id
+}
+
+// ClusterSdnVnetsVnetGet access the API
+// Read sdn vnet configuration.
+func (p ProxmoxVE) ClusterSdnVnetsVnetGet(vnet string) (*ClusterSdnVnetsVnetReturnParameter, error) {
+	path := fmt.Sprintf("/cluster/sdn/vnets/%s", vnet)
+	outp := ClusterSdnVnetsVnetReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return &outp, err
+}
+
+// ClusterSdnZonesZoneReturnParameter represents the returned data from /cluster/sdn/zones/{zone}
+type ClusterSdnZonesZoneReturnParameter struct {
+	Zone string // The SDN zone object identifier.
+	Type string // Plugin type.
+	Ipam string // optional, use a specific ipam
+}
+
+// ClusterSdnZonesZoneGet access the API
+// Read sdn zone configuration.
+func (p ProxmoxVE) ClusterSdnZonesZoneGet(zone string) (*ClusterSdnZonesZoneReturnParameter, error) {
+	path := fmt.Sprintf("/cluster/sdn/zones/%s", zone)
+	outp := ClusterSdnZonesZoneReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return &outp, err
+}
+
+// FindNodeWithMostFreeMemory returns the online cluster node with the most free memory
+func (p ProxmoxVE) FindNodeWithMostFreeMemory() (string, error) {
+	nodes, err := p.ClusterResourcesGet("node")
+	if err != nil {
+		return "", err
+	}
+
+	best := ""
+	var bestFree int64
+	for _, n := range nodes {
+		if n.Status != "online" {
+			continue
+		}
+		free := n.Maxmem - n.Mem
+		if best == "" || free > bestFree {
+			best = n.Node
+			bestFree = free
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no online node found in the cluster")
+	}
+	return best, nil
+}
+
 // NodesNodeQemuPostParameter represents the input data for /nodes/{node}/qemu
 // Original Description:
 // Create or restore a virtual machine.
 type NodesNodeQemuPostParameter struct {
-	VMID      string // The (unique) ID of the VM.
-	Memory    int    // optional, Amount of RAM for the VM in MB. This is the maximum available memory when you use the balloon device.
-	Autostart string // optional, Automatic restart after crash (currently ignored).
-	Agent     string // optional, Enable/disable Qemu GuestAgent.
-	Net0      string
-	Name      string // optional, Set a name for the VM. Only used on the configuration web interface.
-	SCSI0     string // optional, Use volume as VIRTIO hard disk (n is 0 to 15).
-	Onboot    string
-	Ostype    string // optional, Specify guest operating system.
-	KVM       string // optional, Enable/disable KVM hardware virtualization.
-	Pool      string // optional, Add the VM to the specified pool.
-	Sockets   string // optional, The number of CPU sockets.
-	Cores     string // optional, The number of cores per socket.
-	Cdrom     string // optional, This is an alias for option -ide2
-	SshKeys   string // optional, cloud-init: Setup public SSH keys (one key per l ine, OpenSSH format)
-	CPU       string // optional, Emulated CPU type from list with flags if present
-	Numa      int    // optional, Enable/disable NUMA.
-	Citype    string // optional, Cloud-Init Type nocloud for linux configdrive2 for windows
- 	Ciuser    string // optional, username to change ssh keys and pass instead of image's configured default user
-	IDE0      string //
+	VMID        string // The (unique) ID of the VM.
+	Memory      int    // optional, Amount of RAM for the VM in MB. This is the maximum available memory when you use the balloon device.
+	Balloon     string // optional, Amount of target RAM for the VM in MB. Using zero disables the ballon driver.
+	Autostart   string // optional, Automatic restart after crash (currently ignored).
+	Agent       string // optional, Enable/disable Qemu GuestAgent.
+	Net0        string // optional, Specify network devices.
+	Net1        string // optional, Specify network devices.
+	Net2        string // optional, Specify network devices.
+	Net3        string // optional, Specify network devices.
+	Name        string // optional, Set a name for the VM. Only used on the configuration web interface.
+	Description string // optional, Description for the VM. Only used on the configuration web interface. This is saved as comment inside the configuration file.
+	Onboot      bool   // optional, Specifies whether a VM will be started during system bootup.
+	Tags        string // optional, Tags of the VM, separated by semicolons. This is only meta information.
+	Ostype      string // optional, Specify guest operating system.
+	KVM         string // optional, Enable/disable KVM hardware virtualization.
+	Pool        string // optional, Add the VM to the specified pool.
+	Sockets     string // optional, The number of CPU sockets.
+	Cores       string // optional, The number of cores per socket.
+	Cdrom       string // optional, This is an alias for option -ide2
+	SshKeys     string // optional, cloud-init: Setup public SSH keys (one key per l ine, OpenSSH format)
+	CPU         string // optional, Emulated CPU type from list with flags if present
+	Cpulimit    string // optional, Limit of CPU usage.
+	Cpuunits    string // optional, CPU weight for a VM.
+	Numa        int    // optional, Enable/disable NUMA.
+	Citype      string // optional, Cloud-Init Type nocloud for linux configdrive2 for windows
+	Ciuser      string // optional, username to change ssh keys and pass instead of image's configured default user
+	Cipassword  string // optional, cloud-init: Password to assign the user.
+	Ciupgrade   string // optional, cloud-init: do an automatic package upgrade after the first boot, Proxmox VE 8 and later.
+	Ipconfig0   string // optional, cloud-init: Specify IP addresses and gateways for the corresponding interface.
+	Scsihw      string // optional, SCSI controller model
+	Boot        string // optional, Specify guest boot order, e.g. order=scsi0;ide2
+	Bootdisk    string // optional, Enable booting from specified disk.
+	Bios        string // optional, Select BIOS implementation.
+	Efidisk0    string // optional, Configure a Disk for storing EFI vars. Use STORAGE_ID:SIZE_IN_GiB to allocate a new volume.
+	Machine     string // optional, Specifies the Qemu machine type.
+	Vga         string // optional, Select the VGA type, e.g. std, qxl or serial0 to use the serial console.
+	Serial0     string // optional, Create a serial device inside the VM, e.g. socket
+	Hotplug     string // optional, Selectively enable hotplug features. This is a comma separated list of hotplug features: 'network', 'disk', 'cpu', 'memory', 'usb' and 'cloudinit'. Use '0' to disable hotplug completely.
+	Rng0        string // optional, Configure a VirtIO-based Random Number Generator.
+	Args        string // optional, Arbitrary arguments passed to kvm, only allowed for root@pam.
+	CloudInit   string `api:"ide2"` // optional, cloud-init drive in the form <storage>:cloudinit
+
+	Devices map[string]string // optional, disks and other devices keyed by their parameter name, e.g. scsi0 or virtio1
 }
 
 type nNodesNodeQemuPostParameter struct {
@@ -404,25 +941,514 @@ type nNodesNodeQemuPostParameter struct {
 }
 
 // NodesNodeQemuPost access the API
-// Create or restore a virtual machine.
-func (p ProxmoxVE) NodesNodeQemuPost(node string, input *NodesNodeQemuPostParameter) error {
+// Create or restore a virtual machine. Returns the task id of the create task.
+func (p ProxmoxVE) NodesNodeQemuPost(node string, input *NodesNodeQemuPostParameter) (taskid string, err error) {
 	path := fmt.Sprintf("/nodes/%s/qemu", node)
-	data, err1 := json.Marshal(input)
-	if err1 != nil {
+	err = p.post(input, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuReturnParameter represents the returned data from /nodes/{node}/qemu
+// Original Description:
+// Virtual machine index (per node).
+type NodesNodeQemuReturnParameter struct {
+	VMID   int    // The (unique) ID of the VM.
+	Name   string // optional, VM name.
+	Status string // QEMU process status.
+}
+
+// NodesNodeQemuGet access the API
+// Virtual machine index (per node).
+func (p ProxmoxVE) NodesNodeQemuGet(node string) ([]NodesNodeQemuReturnParameter, error) {
+	path := fmt.Sprintf("/nodes/%s/qemu", node)
+	outp := []NodesNodeQemuReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return outp, err
+}
 
+// FindVMIDByName returns the VMID of the only VM on the node with the given name
+func (p ProxmoxVE) FindVMIDByName(node string, name string) (string, error) {
+	vms, err := p.NodesNodeQemuGet(node)
+	if err != nil {
+		return "", err
 	}
-	fmt.Printf("%s\n", data)
 
-	err := p.post(input, nil, path)
+	var found []string
+	for _, vm := range vms {
+		if vm.Name == name {
+			found = append(found, strconv.Itoa(vm.VMID))
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", &vmNotFoundError{name: name, node: node}
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("VM name '%s' is ambiguous on node '%s', found VMIDs %s", name, node, strings.Join(found, ", "))
+}
+
+// NodesNodeQemuVMIDClonePostParameter represents the input data for /nodes/{node}/qemu/{vmid}/clone
+// Original Description:
+// Create a copy of virtual machine/template.
+type NodesNodeQemuVMIDClonePostParameter struct {
+	Newid   string // VMID for the clone.
+	Name    string // optional, Set a name for the new VM.
+	Pool    string // optional, Add the new VM to the specified pool.
+	Storage string // optional, Target storage for full clone.
+	Full    bool   // optional, Create a full copy of all disks. This is always done when you clone a normal VM. For VM templates, we try to create a linked clone by default.
+}
+
+// NodesNodeQemuVMIDClonePost access the API
+// Create a copy of virtual machine/template. Returns the task id of the clone task.
+func (p ProxmoxVE) NodesNodeQemuVMIDClonePost(node string, vmid string, input *NodesNodeQemuVMIDClonePostParameter) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/clone", node, vmid)
+	err = p.post(input, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuVMIDConfigPostParameter represents the input data for /nodes/{node}/qemu/{vmid}/config
+// Original Description:
+// Set virtual machine options (asynchrounous API).
+type NodesNodeQemuVMIDConfigPostParameter struct {
+	Memory      string // optional, Amount of RAM for the VM in MB.
+	Balloon     string // optional, Amount of target RAM for the VM in MB. Using zero disables the ballon driver.
+	Sockets     string // optional, The number of CPU sockets.
+	Cores       string // optional, The number of cores per socket.
+	Cpulimit    string // optional, Limit of CPU usage.
+	Cpuunits    string // optional, CPU weight for a VM.
+	Ciuser      string // optional, cloud-init: User name to change ssh keys and password for instead of the image's configured default user.
+	Cipassword  string // optional, cloud-init: Password to assign the user.
+	Ciupgrade   string // optional, cloud-init: do an automatic package upgrade after the first boot, Proxmox VE 8 and later.
+	SshKeys     string // optional, cloud-init: Setup public SSH keys (one key per line, OpenSSH format).
+	Ipconfig0   string // optional, cloud-init: Specify IP addresses and gateways for the corresponding interface.
+	Description string // optional, Description for the VM. Only used on the configuration web interface. This is saved as comment inside the configuration file.
+	Tags        string // optional, Tags of the VM, separated by semicolons. This is only meta information.
+	Onboot      string // optional, Specifies whether a VM will be started during system bootup.
+	Agent       string // optional, Enable/disable Qemu GuestAgent.
+	Vga         string // optional, Select the VGA type, e.g. std, qxl or serial0 to use the serial console.
+	Serial0     string // optional, Create a serial device inside the VM, e.g. socket
+	Hotplug     string // optional, Selectively enable hotplug features. This is a comma separated list of hotplug features: 'network', 'disk', 'cpu', 'memory', 'usb' and 'cloudinit'. Use '0' to disable hotplug completely.
+	Rng0        string // optional, Configure a VirtIO-based Random Number Generator.
+	Args        string // optional, Arbitrary arguments passed to kvm, only allowed for root@pam.
+	Net0        string // optional, Specify network devices.
+	Net1        string // optional, Specify network devices.
+	Net2        string // optional, Specify network devices.
+	Net3        string // optional, Specify network devices.
+	CPU         string // optional, Emulated CPU type from list with flags if present
+	Numa        string // optional, Enable/disable NUMA.
+	KVM         string // optional, Enable/disable KVM hardware virtualization.
+	Machine     string // optional, Specifies the Qemu machine type.
+	Ostype      string // optional, Specify guest operating system.
+
+	Devices map[string]string // optional, disks and other devices keyed by their parameter name, e.g. ide2
+}
+
+// NodesNodeQemuVMIDConfigReturnParameter represents the returned data from /nodes/{node}/qemu/{vmid}/config
+// Original Description:
+// Get the virtual machine configuration with pending configuration changes applied.
+type NodesNodeQemuVMIDConfigReturnParameter struct {
+	Name        string       // optional, Set a name for the VM.
+	Description string       // optional, Description for the VM.
+	Memory      NumberString // optional, Amount of RAM for the VM in MB, a property string since Proxmox VE 8.1.
+	Sockets     NumberString // optional, The number of CPU sockets.
+	Cores       NumberString // optional, The number of cores per socket.
+	Net0        string       // optional, Specify network devices.
+	Ide0        string       // optional, Use volume as IDE hard disk or CD-ROM.
+	Sata0       string       // optional, Use volume as SATA hard disk or CD-ROM.
+	Scsi0       string       // optional, Use volume as SCSI hard disk or CD-ROM.
+	Virtio0     string       // optional, Use volume as VIRTIO hard disk.
+}
+
+// Disk returns the value of the disk option with the given key like scsi0, empty if it is not known
+func (c *NodesNodeQemuVMIDConfigReturnParameter) Disk(key string) string {
+	switch key {
+	case "ide0":
+		return c.Ide0
+	case "sata0":
+		return c.Sata0
+	case "scsi0":
+		return c.Scsi0
+	case "virtio0":
+		return c.Virtio0
+	}
+	return ""
+}
+
+// MemoryMB returns the configured memory, both the plain number and the current= property string form
+func (c *NodesNodeQemuVMIDConfigReturnParameter) MemoryMB() (int, error) {
+	memory := string(c.Memory)
+	for _, option := range strings.Split(memory, ",") {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) == 1 {
+			return strconv.Atoi(kv[0])
+		}
+		if kv[0] == "current" {
+			return strconv.Atoi(kv[1])
+		}
+	}
+	return 0, fmt.Errorf("memory '%s' can not be parsed", memory)
+}
+
+// QemuNetDevice is a parsed network device like virtio=BC:24:11:00:00:01,bridge=vmbr0,tag=10
+type QemuNetDevice struct {
+	Model      string
+	MACAddress string
+	Bridge     string
+	Tag        int
+	Firewall   bool
+	Options    map[string]string // all options, including the ones above
+}
+
+// ParseQemuNetDevice parses the value of a netN option, the model is given with the MAC address
+// as value (virtio=<mac>) or, if the address is generated, as model=virtio
+func ParseQemuNetDevice(device string) QemuNetDevice {
+	nic := QemuNetDevice{Options: map[string]string{}}
+	for _, option := range strings.Split(device, ",") {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		nic.Options[kv[0]] = kv[1]
+		switch kv[0] {
+		case "model":
+			nic.Model = kv[1]
+		case "macaddr":
+			nic.MACAddress = kv[1]
+		case "bridge":
+			nic.Bridge = kv[1]
+		case "tag":
+			nic.Tag, _ = strconv.Atoi(kv[1])
+		case "firewall":
+			nic.Firewall = kv[1] == "1"
+		default:
+			if _, err := net.ParseMAC(kv[1]); err == nil {
+				nic.Model = kv[0]
+				nic.MACAddress = kv[1]
+			}
+		}
+	}
+	return nic
+}
+
+// QemuDiskDevice is a parsed disk like local-lvm:vm-100-disk-0,cache=writeback,size=16G
+type QemuDiskDevice struct {
+	Volume  string
+	Size    string
+	Options map[string]string // all options except the volume
+}
+
+// ParseQemuDiskDevice parses the value of a disk option like scsi0 or virtio0
+func ParseQemuDiskDevice(device string) QemuDiskDevice {
+	disk := QemuDiskDevice{Options: map[string]string{}}
+	for i, option := range strings.Split(device, ",") {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) == 1 {
+			if i == 0 {
+				disk.Volume = kv[0]
+			}
+			continue
+		}
+		if kv[0] == "file" {
+			disk.Volume = kv[1]
+			continue
+		}
+		disk.Options[kv[0]] = kv[1]
+	}
+	disk.Size = disk.Options["size"]
+	return disk
+}
+
+// SizeBytes returns the size of the disk, the API reports it as bytes or with a K, M, G or T suffix
+func (d QemuDiskDevice) SizeBytes() (int64, error) {
+	size := d.Size
+	shift := uint(0)
+	if size != "" {
+		switch size[len(size)-1] {
+		case 'K':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		case 'T':
+			shift = 40
+		}
+		if shift != 0 {
+			size = size[:len(size)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid disk size '%s'", d.Size)
+	}
+	return int64(value * float64(int64(1)<<shift)), nil
+}
+
+// NodesNodeQemuVMIDConfigGet access the API
+// Get the virtual machine configuration with pending configuration changes applied.
+func (p ProxmoxVE) NodesNodeQemuVMIDConfigGet(node string, vmid string) (*NodesNodeQemuVMIDConfigReturnParameter, error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/config", node, vmid)
+	outp := NodesNodeQemuVMIDConfigReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return &outp, err
+}
+
+// NodesNodeQemuVMIDConfigPost access the API
+// Set virtual machine options (asynchrounous API). Returns the task id of the update task.
+func (p ProxmoxVE) NodesNodeQemuVMIDConfigPost(node string, vmid string, input *NodesNodeQemuVMIDConfigPostParameter) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/config", node, vmid)
+	err = p.post(input, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuVMIDResizePutParameter represents the input data for /nodes/{node}/qemu/{vmid}/resize
+// Original Description:
+// Extend volume size.
+type NodesNodeQemuVMIDResizePutParameter struct {
+	Disk string // The disk you want to resize.
+	Size string // The new size. With the `+` sign the value is added to the actual size of the volume and without it, the value is taken as an absolute one. Shrinking disk size is not supported.
+}
+
+// NodesNodeQemuVMIDResizePut access the API
+// Extend volume size. Returns the task id of the resize task, older Proxmox VE versions resize synchronously and return none.
+func (p ProxmoxVE) NodesNodeQemuVMIDResizePut(node string, vmid string, input *NodesNodeQemuVMIDResizePutParameter) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/resize", node, vmid)
+	err = p.put(input, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuVMIDFirewallOptionsPutParameter represents the input data for /nodes/{node}/qemu/{vmid}/firewall/options
+// Original Description:
+// Set Firewall options.
+type NodesNodeQemuVMIDFirewallOptionsPutParameter struct {
+	Enable bool // Enable/disable firewall rules.
+}
+
+// NodesNodeQemuVMIDFirewallOptionsPut access the API
+// Set Firewall options.
+func (p ProxmoxVE) NodesNodeQemuVMIDFirewallOptionsPut(node string, vmid string, input *NodesNodeQemuVMIDFirewallOptionsPutParameter) error {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/firewall/options", node, vmid)
+	err := p.put(input, nil, path)
 	return err
 }
 
+// NodesNodeQemuVMIDSnapshotPostParameter represents the input data for /nodes/{node}/qemu/{vmid}/snapshot
+// Original Description:
+// Snapshot a VM.
+type NodesNodeQemuVMIDSnapshotPostParameter struct {
+	Snapname    string // The name of the snapshot.
+	Description string // optional, A textual description or comment.
+	Vmstate     bool   // optional, Save the vmstate
+}
+
+// NodesNodeQemuVMIDSnapshotPost access the API
+// Snapshot a VM. Returns the task id of the snapshot task.
+func (p ProxmoxVE) NodesNodeQemuVMIDSnapshotPost(node string, vmid string, input *NodesNodeQemuVMIDSnapshotPostParameter) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/snapshot", node, vmid)
+	err = p.post(input, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuVMIDMigrateReturnParameter represents the returned data from GET /nodes/{node}/qemu/{vmid}/migrate
+// Original Description:
+// Get preconditions for migration.
+type NodesNodeQemuVMIDMigrateReturnParameter struct {
+	AllowedNodes []string `json:"allowed_nodes"` // optional, List nodes allowed for offline migration, only passed if VM is offline
+	LocalDisks   []struct {
+		Volid string `json:"volid"`
+	} `json:"local_disks"` // List local disks including CD-Rom, unsused and not referenced disks
+	LocalResources []string `json:"local_resources"` // List local resources e.g. pci, usb
+}
+
+// NodesNodeQemuVMIDMigrateGet access the API
+// Get preconditions for migration.
+func (p ProxmoxVE) NodesNodeQemuVMIDMigrateGet(node string, vmid string) (*NodesNodeQemuVMIDMigrateReturnParameter, error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/migrate", node, vmid)
+	outp := NodesNodeQemuVMIDMigrateReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return &outp, err
+}
+
+// NodesNodeQemuVMIDMigratePostParameter represents the input data for /nodes/{node}/qemu/{vmid}/migrate
+// Original Description:
+// Migrate virtual machine. Creates a new migration task.
+type NodesNodeQemuVMIDMigratePostParameter struct {
+	Target string // Target node.
+	Online bool   // optional, Use online/live migration if VM is running. Ignored if VM is stopped.
+}
+
+// NodesNodeQemuVMIDMigratePost access the API
+// Migrate virtual machine. Creates a new migration task. Returns the task id of the migration task.
+func (p ProxmoxVE) NodesNodeQemuVMIDMigratePost(node string, vmid string, input *NodesNodeQemuVMIDMigratePostParameter) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/migrate", node, vmid)
+	err = p.post(input, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeTasksUPIDStatusReturnParameter represents the returned data from /nodes/{node}/tasks/{upid}/status
+// Original Description:
+// Read task status.
+type NodesNodeTasksUPIDStatusReturnParameter struct {
+	Status     string // running or stopped
+	Exitstatus string // optional, OK or the error message once the task is stopped
+	Type       string // task type, e.g. qmcreate or qmclone
+	User       string // user that started the task
+}
+
+// NodesNodeTasksUPIDStatusGet access the API
+// Read task status.
+func (p ProxmoxVE) NodesNodeTasksUPIDStatusGet(node string, upid string) (*NodesNodeTasksUPIDStatusReturnParameter, error) {
+	path := fmt.Sprintf("/nodes/%s/tasks/%s/status", node, upid)
+	outp := NodesNodeTasksUPIDStatusReturnParameter{}
+	err := p.get(nil, &outp, path)
+	return &outp, err
+}
+
+// NodesNodeTasksUPIDLogGetParameter represents the input data for /nodes/{node}/tasks/{upid}/log
+// Original Description:
+// Read task log.
+type NodesNodeTasksUPIDLogGetParameter struct {
+	Start int // optional, Start at this line when reading the tasks log
+	Limit int // optional, The amount of lines to read from the tasks log.
+}
+
+// NodesNodeTasksUPIDLogReturnParameter represents the returned data from /nodes/{node}/tasks/{upid}/log
+type NodesNodeTasksUPIDLogReturnParameter struct {
+	N int    // line number
+	T string // line text
+}
+
+// NodesNodeTasksUPIDLogGet access the API
+// Read task log. Returns the requested lines and the total number of lines of the log.
+func (p ProxmoxVE) NodesNodeTasksUPIDLogGet(node string, upid string, input *NodesNodeTasksUPIDLogGetParameter) ([]NodesNodeTasksUPIDLogReturnParameter, int, error) {
+	path := fmt.Sprintf("/nodes/%s/tasks/%s/log", node, upid)
+
+	// the total is returned next to the data, which get drops
+	body, err := p.getRaw(input, path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var outp struct {
+		Data  []NodesNodeTasksUPIDLogReturnParameter `json:"data"`
+		Total int                                    `json:"total"`
+	}
+	err = json.Unmarshal(body, &outp)
+	if err != nil {
+		return nil, 0, err
+	}
+	return outp.Data, outp.Total, nil
+}
+
+// taskLogLines is the number of lines of the log of a failed task included in the error
+const taskLogLines = 5
+
+// taskLogPage is the number of lines read at once, a second page is read from the end of longer logs
+const taskLogPage = 500
+
+// taskLogTail returns the last lines of the task log, without the final TASK ERROR line that repeats the exit status
+func (p ProxmoxVE) taskLogTail(node string, upid string) ([]string, error) {
+	entries, total, err := p.NodesNodeTasksUPIDLogGet(node, upid, &NodesNodeTasksUPIDLogGetParameter{Limit: taskLogPage})
+	if err != nil {
+		return nil, err
+	}
+	if total > len(entries) {
+		// clone and disk move tasks log their progress, the failure is at the end
+		entries, _, err = p.NodesNodeTasksUPIDLogGet(node, upid, &NodesNodeTasksUPIDLogGetParameter{Start: total - taskLogPage, Limit: taskLogPage})
+		if err != nil {
+			return nil, err
+		}
+	}
+	lines := []string{}
+	for _, entry := range entries {
+		line := strings.TrimSpace(entry.T)
+		if line == "" || strings.HasPrefix(line, "TASK ERROR:") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > taskLogLines {
+		lines = lines[len(lines)-taskLogLines:]
+	}
+	return lines, nil
+}
+
+// WaitForTask polls the task until it is stopped and returns an error if it did not finish with OK,
+// the error includes the last lines of the task log
+func (p ProxmoxVE) WaitForTask(node string, upid string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := p.NodesNodeTasksUPIDStatusGet(node, upid)
+		if err != nil {
+			return err
+		}
+		if status.Status == "stopped" {
+			if status.Exitstatus != "OK" {
+				lines, err := p.taskLogTail(node, upid)
+				if err != nil || len(lines) == 0 {
+					log.Debugf("No log of task '%s': %v", upid, err)
+					return fmt.Errorf("task '%s' failed: %s", upid, status.Exitstatus)
+				}
+				return fmt.Errorf("task '%s' failed: %s, task log:\n%s", upid, status.Exitstatus, strings.Join(lines, "\n"))
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("task '%s' did not finish within %s", upid, timeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
 // NodesNodeQemuVMIDStatusStartPost access the API
-// Start virtual machine.
-func (p ProxmoxVE) NodesNodeQemuVMIDStatusStartPost(node string, vmid string) error {
+// Start virtual machine. Returns the task id of the start task.
+func (p ProxmoxVE) NodesNodeQemuVMIDStatusStartPost(node string, vmid string) (taskid string, err error) {
 	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/start", node, vmid)
-	err := p.post(nil, nil, path)
-	return err
+	err = p.post(nil, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuVMIDStatusShutdownPost access the API
+// Shutdown virtual machine. This is similar to pressing the power button on a physical machine. This will send an ACPI event for the guest OS, which should then proceed to a clean shutdown.
+// Returns the task id of the shutdown task, it finishes once the VM is stopped.
+func (p ProxmoxVE) NodesNodeQemuVMIDStatusShutdownPost(node string, vmid string) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/shutdown", node, vmid)
+	err = p.post(nil, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuVMIDStatusRebootPost access the API
+// Reboot the VM by shutting it down, and starting it again. Applies pending changes.
+// Returns the task id of the reboot task, it finishes once the VM was started again.
+func (p ProxmoxVE) NodesNodeQemuVMIDStatusRebootPost(node string, vmid string) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/reboot", node, vmid)
+	err = p.post(nil, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuVMIDStatusSuspendPostParameter represents the input data for /nodes/{node}/qemu/{vmid}/status/suspend
+// Original Description:
+// Suspend virtual machine.
+type NodesNodeQemuVMIDStatusSuspendPostParameter struct {
+	Todisk bool // optional, If set, suspends the VM to disk. Will be resumed on next VM start.
+}
+
+// NodesNodeQemuVMIDStatusSuspendPost access the API
+// Suspend virtual machine. Returns the task id of the suspend task.
+func (p ProxmoxVE) NodesNodeQemuVMIDStatusSuspendPost(node string, vmid string, input *NodesNodeQemuVMIDStatusSuspendPostParameter) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/suspend", node, vmid)
+	err = p.post(input, &taskid, path)
+	return taskid, err
+}
+
+// NodesNodeQemuVMIDStatusResumePost access the API
+// Resume virtual machine. A VM suspended to disk is started again. Returns the task id of the resume task.
+func (p ProxmoxVE) NodesNodeQemuVMIDStatusResumePost(node string, vmid string) (taskid string, err error) {
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/resume", node, vmid)
+	err = p.post(nil, &taskid, path)
+	return taskid, err
 }
 
 // NodesNodeQemuVMIDAgentPostParameter represents the input data for /nodes/{node}/qemu/{vmid}/agent
@@ -433,30 +1459,36 @@ type NodesNodeQemuVMIDAgentPostParameter struct {
 }
 
 // NodesNodeQemuVMIDAgentPost access the API
-// Execute Qemu Guest Agent commands.
-func (p ProxmoxVE) NodesNodeQemuVMIDAgentPost(node string, vmid string, input *NodesNodeQemuVMIDAgentPostParameter) error {
+// Execute Qemu Guest Agent commands. The request is aborted when ctx is done.
+func (p ProxmoxVE) NodesNodeQemuVMIDAgentPost(ctx context.Context, node string, vmid string, input *NodesNodeQemuVMIDAgentPostParameter) error {
 	path := fmt.Sprintf("/nodes/%s/qemu/%s/agent", node, vmid)
-	err := p.post(input, nil, path)
+	err := p.runMethodContext(ctx, "post", input, nil, path)
 	return err
 }
 
-// NodesNodeQemuVMIDDelete access the API
-// Destroy the vm (also delete all used/owned volumes).
-func (p ProxmoxVE) NodesNodeQemuVMIDDelete(node string, vmid string) error {
-	p.NodesNodeQemuVMIDStatusStopPost(node, vmid)
-	time.Sleep(time.Second)
+// NodesNodeQemuVMIDDeleteParameter represents the input data for /nodes/{node}/qemu/{vmid}
+// Original Description:
+// Destroy the VM and  all used/owned volumes. Removes any VM specific permissions and firewall rules
+type NodesNodeQemuVMIDDeleteParameter struct {
+	Purge                    bool // optional, Remove VMID from configurations, like backup & replication jobs and HA.
+	DestroyUnreferencedDisks bool `api:"destroy-unreferenced-disks"` // optional, If set, destroy additionally all disks not referenced in the config but with a matching VMID from all enabled storages.
+}
 
+// NodesNodeQemuVMIDDelete access the API
+// Destroy the vm (also delete all used/owned volumes). The VM must be stopped. Returns the task id of the destroy task.
+func (p ProxmoxVE) NodesNodeQemuVMIDDelete(node string, vmid string, input *NodesNodeQemuVMIDDeleteParameter) (taskid string, err error) {
 	path := fmt.Sprintf("/nodes/%s/qemu/%s", node, vmid)
-	err := p.delete(nil, nil, path)
-	return err
+	err = p.delete(input, &taskid, path)
+	return taskid, err
 }
 
 // NodesNodeQemuVMIDStatusStopPost access the API
 // Stop virtual machine. The qemu process will exit immediately. Thisis akin to pulling the power plug of a running computer and may damage the VM data
-func (p ProxmoxVE) NodesNodeQemuVMIDStatusStopPost(node string, vmid string) error {
+// Returns the task id of the stop task.
+func (p ProxmoxVE) NodesNodeQemuVMIDStatusStopPost(node string, vmid string) (taskid string, err error) {
 	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/stop", node, vmid)
-	err := p.post(nil, nil, path)
-	return err
+	err = p.post(nil, &taskid, path)
+	return taskid, err
 }
 
 func unmarshallString(data string, value string) (string, error) {
@@ -488,64 +1520,197 @@ type IPReturn struct {
 
 // GetEth0IPv4 access the API
 func (p ProxmoxVE) GetEth0IPv4(node string, vmid string) (string, error) {
+	return p.GetInterfaceIPv4(node, vmid, "eth0")
+}
+
+// getAgentInterfaces queries the guest agent for the network interfaces of the VM
+func (p ProxmoxVE) getAgentInterfaces(node string, vmid string) (*IPReturn, error) {
 	input := NodesNodeQemuVMIDAgentPostParameter{Command: "network-get-interfaces"}
 	path := fmt.Sprintf("/nodes/%s/qemu/%s/agent", node, vmid)
 
 	response, err := p.client.R().SetQueryParams(p.structToStringMap(&input)).Post(p.getURL(path))
+	if err != nil {
+		return nil, err
+	}
+	if code := response.StatusCode(); code < 200 || code > 300 {
+		return nil, &apiError{code: code, status: response.Status(), body: response.String()}
+	}
 
 	var a IPReturn
-	resp := response.String()
-	err = json.Unmarshal([]byte(resp), &a)
+	err = json.Unmarshal(response.Body(), &a)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// getIPAMAddress looks up the address leased to net0 of the VM in the IPAM of the SDN zone
+// of its bridge, which knows the addresses handed out by the DHCP of the zone (Proxmox VE 8.1+)
+func (p ProxmoxVE) getIPAMAddress(node string, vmid string, iptype string) (string, error) {
+	config, err := p.NodesNodeQemuVMIDConfigGet(node, vmid)
+	if err != nil {
+		return "", err
+	}
+	nic := ParseQemuNetDevice(config.Net0)
+	if nic.MACAddress == "" || nic.Bridge == "" {
+		return "", nil
+	}
+
+	vnet, err := p.ClusterSdnVnetsVnetGet(nic.Bridge)
+	if notFound(err) {
+		// a plain Linux bridge, nothing leases addresses on it
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	zone, err := p.ClusterSdnZonesZoneGet(vnet.Zone)
+	if err != nil {
+		return "", err
+	}
+	if zone.Ipam == "" {
+		return "", nil
+	}
+
+	mac := nic.MACAddress
+	entries, err := p.ClusterSdnIpamsIpamStatusGet(zone.Ipam)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !strings.EqualFold(entry.Mac, mac) {
+			continue
+		}
+		addr := net.ParseIP(strings.SplitN(entry.IP, "/", 2)[0])
+		if addr == nil || (addr.To4() != nil) != (iptype == "ipv4") {
+			continue
+		}
+		return addr.String(), nil
+	}
+	return "", nil
+}
+
+// nicMAC returns the MAC address of a network device like virtio=BC:24:11:00:00:01,bridge=vmbr0
+func nicMAC(device string) string {
+	return ParseQemuNetDevice(device).MACAddress
+}
+
+// GetInterfaceIPv4 access the API
+// Returns the first IPv4 address of the named interface, or the first non-loopback
+// IPv4 address of any interface if ifname is empty. Link-local addresses are skipped.
+func (p ProxmoxVE) GetInterfaceIPv4(node string, vmid string, ifname string) (string, error) {
+	return p.getInterfaceIP(node, vmid, ifname, "ipv4")
+}
+
+// GetEth0IPv6 access the API
+func (p ProxmoxVE) GetEth0IPv6(node string, vmid string) (string, error) {
+	return p.GetInterfaceIPv6(node, vmid, "eth0")
+}
+
+// GetInterfaceIPv6 access the API
+// Returns the first global-scope IPv6 address of the named interface, or of any
+// interface if ifname is empty.
+func (p ProxmoxVE) GetInterfaceIPv6(node string, vmid string, ifname string) (string, error) {
+	return p.getInterfaceIP(node, vmid, ifname, "ipv6")
+}
+
+// getInterfaceIP returns the first usable address of the given type (ipv4 or ipv6)
+// reported by the guest agent. If the agent does not answer, the address is looked up
+// by the MAC address of net0 in the Proxmox VE IPAM.
+func (p ProxmoxVE) getInterfaceIP(node string, vmid string, ifname string, iptype string) (string, error) {
+	a, err := p.getAgentInterfaces(node, vmid)
+	if agentNotRunning(err) {
+		ip, ipamErr := p.getIPAMAddress(node, vmid, iptype)
+		if ipamErr != nil {
+			return "", fmt.Errorf("IP of VM '%s' not yet available (agent not running): %s, IPAM lookup failed: %s", vmid, err, ipamErr)
+		}
+		if ip == "" {
+			return "", fmt.Errorf("IP of VM '%s' not yet available (agent not running): %s", vmid, err)
+		}
+		return ip, nil
+	}
 	if err != nil {
 		return "", err
 	}
 	for _, nic := range a.Data.Result {
-		if nic.Name == "eth0" {
-			for _, ip := range nic.IPAdresses {
-				if ip.IPAddressType == "ipv4" {
-					return ip.IPAddress, nil
-				}
+		if ifname != "" && nic.Name != ifname {
+			continue
+		}
+		for _, ip := range nic.IPAdresses {
+			if ip.IPAddressType != iptype {
+				continue
 			}
+			addr := net.ParseIP(ip.IPAddress)
+			if addr == nil || !addr.IsGlobalUnicast() {
+				continue
+			}
+			return ip.IPAddress, nil
 		}
 	}
 
-	return "", err
+	return "", nil
+}
+
+// NodesNodeQemuVMIDStatusCurrentReturnParameter represents the returned data from /nodes/{node}/qemu/{vmid}/status/current
+// Original Description:
+// Get virtual machine status.
+type NodesNodeQemuVMIDStatusCurrentReturnParameter struct {
+	Status    string // QEMU process status (running, stopped)
+	Qmpstatus string // optional, VM run state from the 'query-status' QMP monitor command (running, paused, suspended, ...)
+	Name      string // optional, VM name
+	Uptime    int    // optional, Uptime in seconds
+	Lock      string // optional, The current config lock, if any (suspended after suspending to disk)
 }
 
 // NodesNodeQemuVMIDStatusCurrentGet access the API
 // Get virtual machine status.
 func (p ProxmoxVE) NodesNodeQemuVMIDStatusCurrentGet(node string, vmid string) (state.State, error) {
 	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/current", node, vmid)
-	response, err := p.client.R().Get(p.getURL(path))
-	var f map[string]interface{}
-
-	err = json.Unmarshal([]byte(response.String()), &f)
-	if err != nil {
-		return state.Paused, err
-	}
-
-	zz, err := json.Marshal(f["data"])
-	if err != nil {
-		return state.Paused, err
-	}
-
-	err = json.Unmarshal(zz, &f)
+	outp := NodesNodeQemuVMIDStatusCurrentReturnParameter{}
+	err := p.get(nil, &outp, path)
 	if err != nil {
-		return state.Paused, err
+		return state.Error, err
 	}
 
-	log.Warnf("Status is '%s'", f["status"])
+	log.Debugf("Status is '%s', qmpstatus is '%s'", outp.Status, outp.Qmpstatus)
 
-	switch f["status"] {
-	case "running":
-		return state.Running, nil
+	switch outp.Status {
 	case "stopped":
+		if outp.Lock == "suspended" {
+			// suspended to disk, the RAM is restored on resume
+			return state.Saved, nil
+		}
 		return state.Stopped, nil
+	case "running":
+		switch outp.Qmpstatus {
+		case "paused":
+			return state.Paused, nil
+		case "suspended":
+			return state.Saved, nil
+		}
+		return state.Running, nil
 	}
 
 	return state.Error, nil
 }
 
+// NumberString holds values the API returns as number or as string, depending on the Proxmox VE version
+type NumberString string
+
+func (n *NumberString) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*n = NumberString(s)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*n = NumberString(number.String())
+	return nil
+}
+
 type IntBool bool
 
 func (bit IntBool) UnmarshalJSON(data []byte) error {
@@ -2,21 +2,32 @@ package proxmoxve
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"gopkg.in/resty.v1"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	sshrw "github.com/mosolovsa/go_cat_sshfilerw"
+	"github.com/asaskevich/govalidator"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/mcnflag"
@@ -52,12 +63,52 @@ const (
 
 	pveDefaultVmNetBridge           = "vmbr0"
 	pveDefaultVmNetModel            = "virtio"
+	pveMaxVmNetworks                = 4
+	pveMaxVmHostPCI                 = 16
+	pveMaxVmUSB                     = 14 // Proxmox VE 7.1 and later, older versions support 5
+	pveMinVMID                      = 100
+	pveMaxVMID                      = 999999999
+
+	pveIPFamilyIPv4                 = "ipv4"
+	pveIPFamilyIPv6                 = "ipv6"
+	pveIPFamilyAuto                 = "auto"
+	pveDefaultIPFamily              = pveIPFamilyIPv4
 
 	pveDefaultVmCpuSocketCount      = "1"
 	pveDefaultVmCpuCoreCount        = "4"
 	pveDefaultVmCpuType             = "kvm64"
 
+	pveDefaultVmStartTimeout        = 60  // seconds to wait for the VM to run after the start task finished without provision timeout
+	pveDefaultVmShutdownTimeout     = 120 // seconds to wait for a graceful shutdown
+	pveDefaultVmRemoveTimeout       = 30  // seconds to wait for a graceful shutdown before a VM is removed
+	pveDefaultVmRebootTimeout       = 300 // seconds to wait for the guest agent after a reboot
+	pveDefaultProvisionTimeout      = 300 // seconds to wait for the guest to become reachable
+	pveDefaultAgentPingTimeout      = 5   // seconds to wait for the guest agent to answer a ping
+	pveDefaultSSHDialTimeout        = 10  // seconds a single SSH connection attempt may take
+	pveDefaultDiskAllocTimeout      = 600 // seconds the allocation of a single disk volume may take
+	pveDefaultProvisionStartDelay   = 0   // seconds to wait before the guest is polled the first time
+	pveDefaultAPIRetries            = 3   // retries of repeatable API requests on transient failures
+
+	pveSSHMaxPollInterval           = 10 * time.Second // upper limit of the backoff between SSH connection attempts
+	pveSSHKeyInstallAttempts        = 4                // attempts to install the public key if the connection drops
+	pveVmMigrateTimeout             = 1 * time.Hour    // upper limit of the duration of a migration
+
+	pveDefaultVmCloudInitType       = "nocloud"
+	pveDefaultDiskBus               = "scsi"
+	pveDefaultVmScsiHw              = "virtio-scsi-pci"
+	pveIOThreadVmScsiHw             = "virtio-scsi-single" // one controller per disk, needed for IO threads on scsi
+	pveDefaultVmBios                = "seabios"
+	pveDefaultVmMachineType         = "pc"
+	pveDefaultSshKeyType            = "rsa"
+	pveDefaultSshKeyBits            = 2048
+	pveSSHHostKeyIgnore             = "ignore" // accept any host key, the key of a new VM is not known in advance
+	pveSSHHostKeyPin                = "pin"    // trust the key seen first and reject a different one later
+	pveDefaultSSHHostKeyCheck       = pveSSHHostKeyIgnore
+	// only upgrades installed packages, keeps changed config files and never prompts
+	pveDefaultUpgradeCommand        = "sudo -n env DEBIAN_FRONTEND=noninteractive sh -c 'apt-get update && apt-get -y -o Dpkg::Options::=--force-confold upgrade'"
+
 	pveDiverMissingOptionMessageFmt = "proxmoxve driver requires the --%s option"
+	pveRedactedSecret               = "****"
 )
 
 // Command Parameters strings
@@ -67,19 +118,68 @@ const (
 	pveUserParameter                   = "proxmoxve-user"
 	pveRealmParameter                  = "proxmoxve-realm"
 	pvePasswordParameter               = "proxmoxve-password"
+	pveAPITokenIDParameter             = "proxmoxve-api-token-id"
+	pveAPITokenSecretParameter         = "proxmoxve-api-token-secret"
+	pveInsecureTLSParameter            = "proxmoxve-insecure-tls"
+	pveCAFileParameter                 = "proxmoxve-ca-file"
 	pveNodeParameter                   = "proxmoxve-node"
+	pveNodeAutoParameter               = "proxmoxve-node-auto"
 	pvePoolParameter                   = "proxmoxve-pool"
+	pveHAGroupParameter                = "proxmoxve-ha-group"
+	pveVmNameParameter                 = "proxmoxve-vm-name"
+	pveVMIDParameter                   = "proxmoxve-vmid"
+	pveVMIDRangeMinParameter           = "proxmoxve-vmid-range-min"
+	pveVmDescriptionParameter          = "proxmoxve-vm-description"
+	pveTagParameter                    = "proxmoxve-tag"
+	pveOnbootParameter                 = "proxmoxve-onboot"
+	pveAgentParameter                  = "proxmoxve-agent"
+	pveAgentFstrimParameter            = "proxmoxve-agent-fstrim-cloned"
+	pveAgentFreezeFsParameter          = "proxmoxve-agent-freeze-fs-on-backup"
+	pveAgentPingTimeoutParameter       = "proxmoxve-agent-ping-timeout"
+	pveKvmParameter                    = "proxmoxve-kvm"
 	pveImageFileParameter              = "proxmoxve-image-file"
 	pveStorageParameter                = "proxmoxve-storage"
 	pveStorageTypeParameter            = "proxmoxve-storage-type"
+	pveRootDiskStorageParameter        = "proxmoxve-root-disk-storage"
+	pveDiskBusParameter                = "proxmoxve-disk-bus"
+	pveDiskCacheParameter              = "proxmoxve-disk-cache"
+	pveDiskSSDParameter                = "proxmoxve-disk-ssd"
+	pveDiskDiscardParameter            = "proxmoxve-disk-discard"
+	pveDiskIOThreadParameter           = "proxmoxve-disk-iothread"
+	pveDiskPreallocationParameter      = "proxmoxve-disk-format-preallocation"
+	pveDiskAllocTimeoutParameter       = "proxmoxve-disk-alloc-timeout"
+	pveDiskThinParameter               = "proxmoxve-disk-thin"
+	pveInlineDiskParameter             = "proxmoxve-inline-disk"
+	pveExtraDiskParameter              = "proxmoxve-extra-disk"
+	pveHostPCIParameter                = "proxmoxve-hostpci"
+	pveUSBParameter                    = "proxmoxve-usb"
+	pveBiosParameter                   = "proxmoxve-bios"
+	pveMachineTypeParameter            = "proxmoxve-machine-type"
+	pveOsTypeParameter                 = "proxmoxve-ostype"
+	pveBootOrderParameter              = "proxmoxve-boot-order"
+	pveEjectISOParameter               = "proxmoxve-eject-iso"
+	pveVgaParameter                    = "proxmoxve-vga"
+	pveSerialParameter                 = "proxmoxve-serial"
+	pveHotplugParameter                = "proxmoxve-hotplug"
+	pveRngParameter                    = "proxmoxve-rng"
+	pveQemuArgsParameter               = "proxmoxve-qemu-args"
 	pveDiskSizeGbParameter             = "proxmoxve-disksize-gb"
 	pveMemoryGbParameter               = "proxmoxve-memory-gb"
+	pveMemoryMinGbParameter            = "proxmoxve-memory-min-gb"
+	pveMemoryMbParameter               = "proxmoxve-memory-mb"
 	pveGuestUsernameParameter          = "proxmoxve-guest-username"
 	pveGuestPasswordParameter          = "proxmoxve-guest-password"
 
 	pveNetBridgeParameter              = "proxmoxve-net-bridge"
 	pveNetModelParameter               = "proxmoxve-net-model"
 	pveNetVlanTagParameter             = "proxmoxve-net-vlantag"
+	pveNetQueuesParameter              = "proxmoxve-net-queues"
+	pveNetMacAddrParameter             = "proxmoxve-net-macaddr"
+	pveNetRateParameter                = "proxmoxve-net-rate"
+	pveFirewallParameter               = "proxmoxve-firewall"
+	pveNetParameter                    = "proxmoxve-net"
+	pveNetInterfaceParameter           = "proxmoxve-net-interface"
+	pveIPFamilyParameter               = "proxmoxve-ip-family"
 	pveCpuSocketsParameter             = "proxmoxve-cpu-sockets"
 	pveCpuCoresParameter               = "proxmoxve-cpu-cores"
 	pveCpuTypeParameter                = "proxmoxve-cpu-type"
@@ -88,10 +188,38 @@ const (
 
 	pveCpuPcidParameter                = "proxmoxve-cpu-pcid"
 	pveCpuSpecCtlrParameter            = "proxmoxve-cpu-spec-ctrl"
+	pveCpuLimitParameter               = "proxmoxve-cpu-limit"
+	pveCpuUnitsParameter               = "proxmoxve-cpu-units"
 
 	pveGuestSshPrivateKeyParameter     = "proxmoxve-guest-ssh-private-key"
 	pveGuestSshPublicKeyParameter      = "proxmoxve-guest-ssh-public-key"
 	pveGuestSshAuthorizedKeysParameter = "proxmoxve-guest-ssh-authorized-keys"
+	pveSshKeyTypeParameter             = "proxmoxve-ssh-key-type"
+	pveSshKeyBitsParameter             = "proxmoxve-ssh-key-bits"
+	pveSshKeyPathParameter             = "proxmoxve-ssh-key-path"
+	pveSSHKeyStorePathParameter        = "proxmoxve-ssh-key-store-path"
+	pveReplaceAuthKeysParameter        = "proxmoxve-ssh-replace-authorized-keys"
+	pveSSHDialTimeoutParameter         = "proxmoxve-ssh-dial-timeout"
+	pveSSHHostKeyCheckParameter        = "proxmoxve-ssh-host-key-check"
+
+	pveCloudInitParameter              = "proxmoxve-cloudinit"
+	pveCloudInitStorageParameter       = "proxmoxve-cloudinit-storage"
+	pveIPAddressParameter              = "proxmoxve-ip-address"
+	pveGatewayParameter                = "proxmoxve-gateway"
+	pveNetmaskParameter                = "proxmoxve-netmask"
+
+	pveCloneVMIDParameter              = "proxmoxve-clone-vmid"
+	pveCloneFullParameter              = "proxmoxve-clone-full"
+	pveCloneTemplateNameParameter      = "proxmoxve-clone-template-name"
+
+	pveProvisionTimeoutParameter       = "proxmoxve-provision-timeout"
+	pveProvisionStartDelayParameter    = "proxmoxve-provision-start-delay"
+	pveProvisionScriptParameter        = "proxmoxve-provision-script"
+	pveNoStartParameter                = "proxmoxve-no-start"
+	pveUpgradeCommandParameter         = "proxmoxve-upgrade-command"
+
+	pveAPIRetriesParameter             = "proxmoxve-api-retries"
+	pveDryRunParameter                 = "proxmoxve-dry-run"
 
 	pveDriverDebugParameter            = "proxmoxve-driver-debug"
 	pveRestyDebugParameter             = "proxmoxve-resty-debug"
@@ -110,18 +238,62 @@ type Driver struct {
 	Host                   string // Proxmox VE Server Host name
 	Port                   int    // Proxmox VE Server listening port
 	Node                   string // optional, node to create VM on, host used if omitted but must match internal node name
+	NodeAuto               bool   // select the online node with the most free memory instead of Node
 	User                   string // username
 	Password               string // password
 	Realm                  string // realm, e.g. pam, pve, etc.
+	APITokenID             string // API token id in the form user@realm!tokenid, used instead of password if given
+	APITokenSecret         string // API token secret
+	InsecureTLS            bool   // skip verification of the server certificate
+	CAFile                 string // optional, PEM bundle used to verify the server certificate
+	APITicket              string    // cached login ticket, reused by later driver calls until it expires
+	APICSRFPreventionToken string    // CSRF token belonging to APITicket
+	APITicketExpiry        time.Time // expiry of APITicket
 
 	// File to load as boot image RancherOS/Boot2Docker
 	ImageFile              string // in the format <storagename>:iso/<filename>.iso
 
+	VMName                 string // optional, name of the VM in Proxmox VE, defaults to the machine name
+	RequestedVMID          string // optional, VMID to create the VM with instead of the next free one
+	VMIDRangeMin           int    // optional, lowest VMID that is allocated automatically, cluster default if 0
 	Pool                   string // pool to add the VM to (necessary for users with only pool permission)
+	HAGroup                string // optional, HA group the VM is managed by
+	Description            string // optional, description shown in the Proxmox VE UI, defaults to a note naming the machine
+	Tags                   []string // optional, tags of the VM (Proxmox VE 7+)
+	Onboot                 bool   // start the VM when the Proxmox VE host boots
+	NoAgent                bool   // the guest runs no QEMU guest agent, SSH is polled and a static IP is needed, false for machines created before the option
+	AgentFstrim            bool   // let the agent trim the disks after moving or migrating a clone
+	AgentFreezeFs          bool   // let the agent freeze the file systems during backups and snapshots
+	AgentPingTimeout       int    // seconds to wait for the guest agent to answer a ping
+	KVM                    bool   // use KVM hardware virtualization, disable in nested environments without VMX/SVM
 	Storage                string // internal PVE storage name
 	StorageType            string // Type of the storage (currently QCOW2 and RAW)
+	RootDiskStorage        string // storage for the root disk, defaults to Storage
 	DiskSize               string // disk size in GB
-	Memory                 int    // memory in GB
+	DiskBus                string // bus of the root disk (scsi, virtio, sata or ide)
+	DiskCache              string // optional, cache mode of the root disk, Proxmox VE default if empty
+	DiskSSD                bool   // present the root disk as SSD to the guest
+	DiskDiscard            bool   // pass discard/TRIM requests to the storage
+	DiskIOThread           bool   // give the root disk its own IO thread
+	DiskPreallocation      string // optional, preallocation of disk files on dir storages, storage default if empty
+	DiskAllocTimeout       int    // seconds the allocation of a single disk volume may take
+	DiskThin               bool   // require thin provisioned disks
+	InlineDisk             bool   // let Proxmox VE allocate the root disk while creating the VM
+	ExtraDisks             []string // optional, additional data disks in the form size=50G,storage=local-lvm,bus=scsi
+	HostPCI                []string // optional, PCI devices to pass through like 0000:01:00,pcie=1,x-vga=1
+	USB                    []string // optional, USB devices to pass through like host=1234:5678,usb3=1
+	Bios                   string // BIOS implementation, seabios or ovmf (UEFI)
+	MachineType            string // QEMU machine type, e.g. pc, q35 or pinned versions like pc-q35-7.2
+	OsType                 string // guest operating system, e.g. l26, win11 or other
+	BootOrder              string // optional, devices to boot from like scsi0;ide2, root disk then boot image if empty
+	EjectISO               bool   // eject the boot image after provisioning
+	Vga                    string // optional, display type like std, qxl or serial0, Proxmox VE default if empty
+	Serial                 bool   // add a serial0 socket device for the serial console
+	Hotplug                string // optional, comma separated hotplug types like disk,network,cpu, Proxmox VE default if empty
+	Rng                    bool   // add a virtio-rng device fed by /dev/urandom
+	QemuArgs               string // optional, extra arguments passed to QEMU as is
+	Memory                 int    // memory in MB, given in GB or MB by the flags
+	MemoryMin              int    // optional, lower bound for the balloon device in MB, given in GB by the flags, ballooning is not configured if 0
 	StorageFilename        string
 
 	VMID                   string // VM ID only filled by create()
@@ -134,6 +306,13 @@ type Driver struct {
 	NetBridge              string // Net was defaulted to vmbr0, but should accept any other config i.e vmbr1
 	NetModel               string // Net Interface Model, [e1000, virtio, realtek, etc...]
 	NetVlanTag             int // VLAN
+	NetQueues              int    // optional, number of virtio-net queues (multiqueue)
+	NetMacAddr             string // optional, fixed MAC address of net0, generated by Proxmox VE if empty
+	NetRate                string // optional, rate limit of net0 in MB/s, fractions allowed
+	Firewall               bool   // enable the Proxmox VE firewall on net0 and the VM
+	Networks               []string // optional, full netX definitions, replaces NetBridge, NetModel and NetVlanTag if given
+	NetInterface           string // optional, guest interface to take the IP address from, first non-loopback if empty
+	IPFamily               string // address family used to reach the guest: ipv4, ipv6 or auto
 	Cores                  string // # of cores on each cpu socket
 	Sockets                string // # of cpu sockets
 
@@ -141,39 +320,137 @@ type Driver struct {
 	Numa                   bool
 	Pcid                   bool
 	SpecCtrl               bool
+	CpuLimit               string // optional, limit of CPU usage in number of cores, fractions allowed, 0 means unlimited
+	CpuUnits               int    // optional, CPU weight relative to the other VMs, Proxmox VE default if 0
 
 	GuestSSHPrivateKey     string
 	GuestSSHPublicKey      string
 	GuestSSHAuthorizedKeys string
-
+	SSHKeyType             string // type of the generated SSH key, rsa or ed25519
+	SSHKeyBits             int    // size of a generated RSA key
+	SSHKeyFile             string // optional, existing private key (with .pub beside it) to use instead of generating one
+	SSHKeyStorePath        string // optional, directory for the machine's key pair instead of the docker-machine store
+	ReplaceAuthorizedKeys  bool   // overwrite authorized_keys of the guest user instead of appending the key
+	SSHDialTimeout         int    // seconds a single SSH connection attempt may take
+	SSHHostKeyCheck        string // how the host key of the guest is verified, ignore or pin
+
+	CloudInit              bool   // provision the guest via a cloud-init drive instead of SSH
+	CloudInitStorage       string // storage for the cloud-init drive, defaults to Storage
+	StaticIPAddress        string // optional, static address (plain or CIDR) configured through cloud-init
+	StaticGateway          string // optional, default gateway for the static address
+	StaticNetmask          string // optional, netmask or prefix length if StaticIPAddress is not in CIDR notation
+
+	CloneVMID              string // optional, VMID of the template to clone instead of booting ImageFile
+	CloneFull              bool   // create a full instead of a linked clone
+	CloneTemplateName      string // optional, name of the template to clone, resolved to CloneVMID on create
+
+	ProvisionTimeout       int    // seconds to wait for the guest to become reachable
+	ProvisionStartDelay    int    // seconds to wait before the guest is polled the first time
+	ProvisionScript        string // optional, local shell script run on the guest once SSH is prepared
+	NoStart                bool   // create the VM stopped, it is provisioned on the first start
+	ProvisionPending       bool   // the VM was created stopped and has not been provisioned yet
+	UpgradeCommand         string // command Upgrade runs on the guest
+	APIRetries             int    // retries of repeatable API requests on transient failures
+	DryRun                 bool   // validate and log the create parameters without creating anything
+
+	adopted                bool   // PreCreateCheck found the VM of an earlier, failed create
 }
 
 func (d *Driver) debugf(format string, v ...interface{}) {
 	if d.driverDebug {
-		log.Infof(fmt.Sprintf(format, v...))
+		log.Debugf(format, v...)
 	}
 }
 
 func (d *Driver) debug(v ...interface{}) {
 	if d.driverDebug {
-		log.Info(v...)
+		log.Debug(v...)
+	}
+}
+
+// warnf logs a problem the driver works around or leaves to the user, it is shown without debugging
+func (d *Driver) warnf(format string, v ...interface{}) {
+	log.Warnf(format, v...)
+}
+
+// errorf logs a failure that can not be returned, e.g. while cleaning up after another error
+func (d *Driver) errorf(format string, v ...interface{}) {
+	log.Errorf(format, v...)
+}
+
+// connectionInfo describes the API connection for logging, secrets are always redacted
+func (d *Driver) connectionInfo() string {
+	if d.APITokenID != "" {
+		return fmt.Sprintf("%s:%d with API token '%s'", d.Host, d.Port, d.APITokenID)
+	}
+	return fmt.Sprintf("%s:%d as %s@%s with password '%s'", d.Host, d.Port, d.User, d.Realm, pveRedactedSecret)
+}
+
+// tlsConfig builds the TLS settings for the API connection from the flags
+func (d *Driver) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: d.InsecureTLS}
+
+	if d.CAFile != "" {
+		caCert, err := ioutil.ReadFile(d.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read CA file '%s': %s", d.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("Could not parse any PEM certificate from CA file '%s'", d.CAFile)
+		}
+		config.RootCAs = pool
 	}
+
+	return config, nil
 }
 
 func (d *Driver) connectAPI() error {
 	if d.driver == nil {
 		d.debugf("Create called")
 
-		d.debugf("Connecting to %s as %s@%s with password '%s'", d.Host, d.User, d.Realm, d.Password)
-		c, err := GetProxmoxVEConnectionByValues(d.User, d.Password, d.Realm, d.Host)
-		d.driver = c
+		tlsConfig, err := d.tlsConfig()
+		if err != nil {
+			return err
+		}
+
+		data := &ProxmoxVE{
+			Host:      d.Host,
+			Port:      d.Port,
+			Retries:   d.APIRetries,
+			Debug:     d.driverDebug,
+			TLSConfig: tlsConfig,
+		}
+		if d.APITokenID != "" {
+			data.TokenID = d.APITokenID
+			data.tokenSecret = d.APITokenSecret
+		} else {
+			data.Username = d.User
+			data.password = d.Password
+			data.Realm = d.Realm
+			data.Ticket = d.APITicket
+			data.CSRFPreventionToken = d.APICSRFPreventionToken
+			data.TicketExpiry = d.APITicketExpiry
+		}
+
+		d.debugf("Connecting to %s", d.connectionInfo())
+		c, err := GetProxmoxVEConnection(data)
 		if err != nil {
-			return fmt.Errorf("Could not connect to host '%s' with '%s@%s'", d.Host, d.User, d.Realm)
+			// leave the driver unset, the next call has to connect again
+			if d.APITokenID != "" {
+				return fmt.Errorf("Could not connect to host '%s' with API token '%s': %s", d.Host, d.APITokenID, err)
+			}
+			return fmt.Errorf("Could not connect to host '%s' with '%s@%s': %s", d.Host, d.User, d.Realm, err)
 		}
+		d.driver = c
+		// keep the ticket so the next driver call does not have to log in again
+		d.APITicket = c.Ticket
+		d.APICSRFPreventionToken = c.CSRFPreventionToken
+		d.APITicketExpiry = c.TicketExpiry
 		if d.restyDebug {
 			c.EnableDebugging()
 		}
-		d.debugf("Connected to PVE version '" + d.driver.Version + "'")
+		d.debugf("Connected to PVE version '%s'", d.driver.Version)
 	}
 	return nil
 }
@@ -198,6 +475,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Node name",
 			Value:  "",
 		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_NODE_AUTO",
+			Name:   pveNodeAutoParameter,
+			Usage:  "Create the VM on the online cluster node with the most free memory",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_USER",
 			Name:   pveUserParameter,
@@ -216,6 +498,29 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "User Password",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_API_TOKEN_ID",
+			Name:   pveAPITokenIDParameter,
+			Usage:  "API Token ID in the form user@realm!tokenid (used instead of password)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_API_TOKEN_SECRET",
+			Name:   pveAPITokenSecretParameter,
+			Usage:  "API Token Secret",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_INSECURE_TLS",
+			Name:   pveInsecureTLSParameter,
+			Usage:  "Skip verification of the server TLS certificate",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_CA_FILE",
+			Name:   pveCAFileParameter,
+			Usage:  "PEM encoded CA bundle to verify the server TLS certificate",
+			Value:  "",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_STORAGE",
 			Name:   pveStorageParameter,
@@ -225,8 +530,137 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_STORAGE_TYPE",
 			Name:   pveStorageTypeParameter,
-			Usage:  "Storage type (QCOW2 or RAW)",
-			Value:  pveDefaultStorageType,
+			Usage:  "Storage type (QCOW2 or RAW), defaults to RAW",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_ROOT_DISK_STORAGE",
+			Name:   pveRootDiskStorageParameter,
+			Usage:  "Storage location for the root disk (default: same as --" + pveStorageParameter + ")",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_DISK_BUS",
+			Name:   pveDiskBusParameter,
+			Usage:  "Bus of the root disk (scsi, virtio, sata or ide)",
+			Value:  pveDefaultDiskBus,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_DISK_CACHE",
+			Name:   pveDiskCacheParameter,
+			Usage:  "Cache mode of the root disk (none, writeback, writethrough, directsync or unsafe)",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_DISK_SSD",
+			Name:   pveDiskSSDParameter,
+			Usage:  "Present the root disk as SSD to the guest (not available on virtio)",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_DISK_DISCARD",
+			Name:   pveDiskDiscardParameter,
+			Usage:  "Pass discard/TRIM requests of the guest to the storage",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_DISK_IOTHREAD",
+			Name:   pveDiskIOThreadParameter,
+			Usage:  "Use a dedicated IO thread for the root disk (scsi and virtio only, scsi switches to the virtio-scsi-single controller)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_DISK_FORMAT_PREALLOCATION",
+			Name:   pveDiskPreallocationParameter,
+			Usage:  "Preallocation of disk files on dir storages (off, metadata, falloc or full), ignored on other storages",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_DISK_THIN",
+			Name:   pveDiskThinParameter,
+			Usage:  "Require thin provisioned disks, fails on storages that only allocate thick volumes",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_INLINE_DISK",
+			Name:   pveInlineDiskParameter,
+			Usage:  "Let Proxmox VE allocate the root disk as part of the VM creation instead of allocating the volume first",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_DISK_ALLOC_TIMEOUT",
+			Name:   pveDiskAllocTimeoutParameter,
+			Usage:  "Seconds the allocation of a single disk volume may take, independent of --" + pveProvisionTimeoutParameter,
+			Value:  pveDefaultDiskAllocTimeout,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_EXTRA_DISK",
+			Name:   pveExtraDiskParameter,
+			Usage:  "Additional data disk like 'size=50G,storage=local-lvm,bus=scsi', repeat for each disk",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_HOSTPCI",
+			Name:   pveHostPCIParameter,
+			Usage:  "PCI device to pass through like '0000:01:00,pcie=1,x-vga=1', repeat for each device, requires q35 and ovmf",
+			Value:  []string{},
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_USB",
+			Name:   pveUSBParameter,
+			Usage:  "USB device to pass through by vendor:product or bus-port like 'host=1234:5678' or 'host=1-2,usb3=1', repeat for each device",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_BIOS",
+			Name:   pveBiosParameter,
+			Usage:  "BIOS implementation (seabios or ovmf for UEFI)",
+			Value:  pveDefaultVmBios,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_MACHINE_TYPE",
+			Name:   pveMachineTypeParameter,
+			Usage:  "QEMU machine type (pc, q35 or a pinned version like pc-q35-7.2)",
+			Value:  pveDefaultVmMachineType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_OSTYPE",
+			Name:   pveOsTypeParameter,
+			Usage:  "Guest operating system (l26, l24, win11, win10, win8, win7, wvista, w2k8, w2k3, w2k, wxp, solaris or other)",
+			Value:  pveDefaultVmOsType,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_BOOT_ORDER",
+			Name:   pveBootOrderParameter,
+			Usage:  "Boot order of the VM like 'scsi0;ide2' (default root disk, then boot image)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_EJECT_ISO",
+			Name:   pveEjectISOParameter,
+			Usage:  "Eject the boot image after provisioning (true or false, default true with --" + pveCloudInitParameter + " as the OS runs from the image otherwise)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VGA",
+			Name:   pveVgaParameter,
+			Usage:  "Display type (std, cirrus, vmware, qxl, virtio, none or serial0 for the serial console), optionally with ',memory=<MB>'",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_SERIAL",
+			Name:   pveSerialParameter,
+			Usage:  "Add a serial console (serial0=socket) to the VM",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_HOTPLUG",
+			Name:   pveHotplugParameter,
+			Usage:  "Comma separated hotplug types (disk, network, usb, memory, cpu, cloudinit), 0 to disable, Proxmox VE default (network,disk,usb) if empty",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_RNG",
+			Name:   pveRngParameter,
+			Usage:  "Add a VirtIO RNG device backed by /dev/urandom, speeds up booting images that wait for entropy",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_QEMU_ARGS",
+			Name:   pveQemuArgsParameter,
+			Usage:  "Extra arguments passed to QEMU as is, e.g. '-cpu host,+invtsc', not validated and only allowed for root@pam",
+			Value:  "",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_IMAGE_FILE",
@@ -240,6 +674,76 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Pool to attach VM",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_HA_GROUP",
+			Name:   pveHAGroupParameter,
+			Usage:  "HA group to manage the VM by, the VM is not HA managed if empty",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_NAME",
+			Name:   pveVmNameParameter,
+			Usage:  "Name of the VM in Proxmox VE, also used as hostname by cloud-init (default the machine name)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VMID",
+			Name:   pveVMIDParameter,
+			Usage:  "VMID of the new VM, it must be free (default the next free VMID)",
+			Value:  "",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_VMID_RANGE_MIN",
+			Name:   pveVMIDRangeMinParameter,
+			Usage:  "Allocate the first free VMID at or above this one instead of the next free VMID of the cluster",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_VM_DESCRIPTION",
+			Name:   pveVmDescriptionParameter,
+			Usage:  "Description (notes) of the VM, may contain multiple lines (default 'Created by docker-machine: <machine name>')",
+			Value:  "",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_TAG",
+			Name:   pveTagParameter,
+			Usage:  "Tag of the VM (lowercase letters, digits, '-', '_' and '.'), repeat for each tag",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_ONBOOT",
+			Name:   pveOnbootParameter,
+			Usage:  "Start the VM when the Proxmox VE host boots (true or false)",
+			Value:  pveDefaultVmOnBoot,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_AGENT",
+			Name:   pveAgentParameter,
+			Usage:  "Enable the QEMU guest agent (true or false), requires --" + pveIPAddressParameter + " if disabled",
+			Value:  pveDefaultVmAgent,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_AGENT_FSTRIM_CLONED",
+			Name:   pveAgentFstrimParameter,
+			Usage:  "Let the guest agent run fstrim after moving a disk or migrating the VM",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_AGENT_FREEZE_FS_ON_BACKUP",
+			Name:   pveAgentFreezeFsParameter,
+			Usage:  "Let the guest agent freeze the file systems for consistent backups and snapshots (true or false)",
+			Value:  "true",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_AGENT_PING_TIMEOUT",
+			Name:   pveAgentPingTimeoutParameter,
+			Usage:  "Seconds to wait for the guest agent to answer a ping before the VM is reported as not reachable",
+			Value:  pveDefaultAgentPingTimeout,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_KVM",
+			Name:   pveKvmParameter,
+			Usage:  "Enable KVM hardware virtualization (true or false), disable in nested environments without VMX/SVM",
+			Value:  pveDefaultVmKvm,
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_DISKSIZE_GB",
 			Name:   pveDiskSizeGbParameter,
@@ -252,6 +756,16 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "RAM Memory in GB",
 			Value:  pveDefaultVmMemorySizeGb,
 		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_MEMORY_MB",
+			Name:   pveMemoryMbParameter,
+			Usage:  "RAM Memory in MB, takes precedence over --" + pveMemoryGbParameter,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_MEMORY_MIN_GB",
+			Name:   pveMemoryMinGbParameter,
+			Usage:  "Minimum RAM Memory in GB the balloon device may shrink the VM to (default: no ballooning configured)",
+		},
 		mcnflag.StringFlag{
 			Name:   pveGuestUsernameParameter,
 			Usage:  "Guest OS account Username (default docker for boot2docker)",
@@ -262,6 +776,46 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Guest OS account Password (default tcuser for boot2docker)",
 			Value:  pveDefaultVmGuestUserPassword,
 		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_PROVISION_TIMEOUT",
+			Name:   pveProvisionTimeoutParameter,
+			Usage:  "Seconds to wait for the VM to become reachable",
+			Value:  pveDefaultProvisionTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_PROVISION_START_DELAY",
+			Name:   pveProvisionStartDelayParameter,
+			Usage:  "Seconds to wait after start before polling the VM",
+			Value:  pveDefaultProvisionStartDelay,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_PROVISION_SCRIPT",
+			Name:   pveProvisionScriptParameter,
+			Usage:  "Local shell script to run as the guest user once the SSH key is installed, create fails if it exits non-zero",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_NO_START",
+			Name:   pveNoStartParameter,
+			Usage:  "Create the VM without starting it, the SSH key is installed on the first start",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_UPGRADE_COMMAND",
+			Name:   pveUpgradeCommandParameter,
+			Usage:  "Command run on the guest to upgrade it, the default upgrades the packages of Debian based guests",
+			Value:  pveDefaultUpgradeCommand,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_API_RETRIES",
+			Name:   pveAPIRetriesParameter,
+			Usage:  "Retries with exponential backoff of repeatable API requests on transient failures",
+			Value:  pveDefaultAPIRetries,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_DRY_RUN",
+			Name:   pveDryRunParameter,
+			Usage:  "Validate the configuration and log the parameters the VM would be created with, without creating it",
+		},
 		mcnflag.BoolFlag{
 			Name:  pveRestyDebugParameter,
 			Usage: "Enables the resty debugging",
@@ -287,6 +841,46 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   pveNetVlanTagParameter,
 			Usage:  "Network VLan Tag (1 - 4094)",
 		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_NET_QUEUES",
+			Name:   pveNetQueuesParameter,
+			Usage:  "Number of packet queues of the virtio network interface (1 - 64)",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_NET_MACADDR",
+			Name:   pveNetMacAddrParameter,
+			Usage:  "Fixed MAC address of the network interface like 'BC:24:11:00:00:01' (default generated by Proxmox VE)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_NET_RATE",
+			Name:   pveNetRateParameter,
+			Usage:  "Rate limit of the network interface in MB/s, e.g. 12.5 (applies to this interface only)",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_FIREWALL",
+			Name:   pveFirewallParameter,
+			Usage:  "Enable the Proxmox VE firewall on the network interface and the VM",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "PROXMOXVE_NET",
+			Name:   pveNetParameter,
+			Usage:  "Network interface definition like 'model=virtio,bridge=vmbr1,tag=100', repeat for each interface (max 4)",
+			Value:  []string{},
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_NET_INTERFACE",
+			Name:   pveNetInterfaceParameter,
+			Usage:  "Guest interface (e.g. eth0, ens18) to read the IP address from, first non-loopback interface if empty",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_IP_FAMILY",
+			Name:   pveIPFamilyParameter,
+			Usage:  "Address family used to reach the guest: ipv4, ipv6 or auto (prefer IPv4, fall back to IPv6)",
+			Value:  pveDefaultIPFamily,
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_CPU_SOCKETS",
 			Name:   pveCpuSocketsParameter,
@@ -302,8 +896,8 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_CPU_TYPE",
 			Name:   pveCpuTypeParameter,
-			Usage:  "CPU Type (kvm32, kvm64, host, etc)",
-			Value:  pveDefaultVmCpuType,
+			Usage:  "CPU Type (host, kvm64, x86-64-v2-AES, etc, optionally with ',flags=+aes'), Proxmox VE default if empty",
+			Value:  "",
 		},
 		mcnflag.BoolFlag{
 			EnvVar: "PROXMOXVE_CPU_NUMA",
@@ -320,6 +914,17 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   pveCpuSpecCtlrParameter,
 			Usage:  "Enable cpu spec-ctrl option",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_CPU_LIMIT",
+			Name:   pveCpuLimitParameter,
+			Usage:  "Limit of CPU usage in cores (0 - 128, fractions allowed), 0 means unlimited",
+			Value:  "",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_CPU_UNITS",
+			Name:   pveCpuUnitsParameter,
+			Usage:  "CPU weight of the VM relative to all other VMs (1 - 10000 on Proxmox VE 7 and later, 2 - 262144 before), Proxmox VE default if empty",
+		},
 		mcnflag.StringFlag{
 			EnvVar: "PROXMOXVE_GUEST_SSH_PRIVATE_KEY",
 			Name:   pveGuestSshPrivateKeyParameter,
@@ -338,6 +943,93 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "SSH Authorized Keys on Guest OS",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_SSH_KEY_TYPE",
+			Name:   pveSshKeyTypeParameter,
+			Usage:  "Type of the generated SSH key (rsa or ed25519)",
+			Value:  pveDefaultSshKeyType,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_SSH_KEY_BITS",
+			Name:   pveSshKeyBitsParameter,
+			Usage:  "Size of the generated RSA key, e.g. 2048, 3072 or 4096",
+			Value:  pveDefaultSshKeyBits,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_SSH_KEY_PATH",
+			Name:   pveSshKeyPathParameter,
+			Usage:  "Existing SSH private key to use instead of generating one, the public key is read from <path>.pub",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_SSH_KEY_STORE_PATH",
+			Name:   pveSSHKeyStorePathParameter,
+			Usage:  "Directory (mode 0700) to keep the machine's SSH key pair in instead of the docker-machine store",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_SSH_REPLACE_AUTHORIZED_KEYS",
+			Name:   pveReplaceAuthKeysParameter,
+			Usage:  "Replace the authorized_keys of the guest user instead of appending the key",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "PROXMOXVE_SSH_DIAL_TIMEOUT",
+			Name:   pveSSHDialTimeoutParameter,
+			Usage:  "Seconds a single SSH connection attempt to the VM may take",
+			Value:  pveDefaultSSHDialTimeout,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_SSH_HOST_KEY_CHECK",
+			Name:   pveSSHHostKeyCheckParameter,
+			Usage:  "Verification of the VM's SSH host key: ignore accepts any key, pin records the first key in the machine's known_hosts and rejects a different one",
+			Value:  pveDefaultSSHHostKeyCheck,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_CLOUDINIT",
+			Name:   pveCloudInitParameter,
+			Usage:  "Provision the guest user and SSH keys through a cloud-init drive",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_CLOUDINIT_STORAGE",
+			Name:   pveCloudInitStorageParameter,
+			Usage:  "Storage location for the cloud-init drive (default: same as --" + pveStorageParameter + ")",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_IP_ADDRESS",
+			Name:   pveIPAddressParameter,
+			Usage:  "Static IPv4 or IPv6 address, plain or in CIDR notation (requires --" + pveCloudInitParameter + ", default: DHCP)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_GATEWAY",
+			Name:   pveGatewayParameter,
+			Usage:  "Default gateway for the static IP address",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_NETMASK",
+			Name:   pveNetmaskParameter,
+			Usage:  "Netmask or prefix length for the static IP address (e.g. 255.255.255.0 or 24)",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_CLONE_VMID",
+			Name:   pveCloneVMIDParameter,
+			Usage:  "VMID of the template to clone instead of creating a VM from the image file",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "PROXMOXVE_CLONE_TEMPLATE_NAME",
+			Name:   pveCloneTemplateNameParameter,
+			Usage:  "Name of the template to clone (alternative to --" + pveCloneVMIDParameter + ")",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "PROXMOXVE_CLONE_FULL",
+			Name:   pveCloneFullParameter,
+			Usage:  "Create a full clone instead of a linked clone",
+		},
 	}
 }
 
@@ -346,8 +1038,11 @@ func (d *Driver) ping() bool {
 		return false
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), d.agentPingTimeout())
+	defer cancel()
+
 	command := NodesNodeQemuVMIDAgentPostParameter{Command: "ping"}
-	err := d.driver.NodesNodeQemuVMIDAgentPost(d.Node, d.VMID, &command)
+	err := d.driver.NodesNodeQemuVMIDAgentPost(ctx, d.Node, d.VMID, &command)
 
 	if err != nil {
 		d.debug(err)
@@ -357,6 +1052,39 @@ func (d *Driver) ping() bool {
 	return true
 }
 
+// agentPingTimeout returns how long a guest agent ping may take, machines
+// created before the timeout was configurable fall back to the default
+func (d *Driver) agentPingTimeout() time.Duration {
+	if d.AgentPingTimeout <= 0 {
+		return pveDefaultAgentPingTimeout * time.Second
+	}
+	return time.Duration(d.AgentPingTimeout) * time.Second
+}
+
+// reachable checks if the guest is up, using the guest agent if it is enabled
+// and a TCP connect to the SSH port otherwise
+func (d *Driver) reachable() bool {
+	if !d.NoAgent {
+		return d.ping()
+	}
+
+	hostname, err := d.GetSSHHostname()
+	if err != nil || hostname == "" {
+		return false
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", hostname, port), 2*time.Second)
+	if err != nil {
+		d.debug(err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
 // DriverName returns the name of the driver
 func (d *Driver) DriverName() string {
 	return pveDriverName
@@ -368,6 +1096,7 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	// Required Parameters:
 	d.Host                   = flags.String(pveHostParameter)
 	d.Node                   = flags.String(pveNodeParameter)
+	d.NodeAuto               = flags.Bool(pveNodeAutoParameter)
 	d.Password               = flags.String(pvePasswordParameter)
 	d.ImageFile              = flags.String(pveImageFileParameter)
 
@@ -377,8 +1106,33 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.Realm                  = flags.String(pveRealmParameter)
 	d.Storage                = flags.String(pveStorageParameter)
 	d.StorageType            = strings.ToLower(flags.String(pveStorageTypeParameter))
+	d.RootDiskStorage        = flags.String(pveRootDiskStorageParameter)
 	d.DiskSize               = flags.String(pveDiskSizeGbParameter)
-	d.Memory                 = flags.Int(pveMemoryGbParameter)
+	d.DiskBus                = strings.ToLower(flags.String(pveDiskBusParameter))
+	d.DiskCache              = strings.ToLower(flags.String(pveDiskCacheParameter))
+	d.DiskSSD                = flags.Bool(pveDiskSSDParameter)
+	d.DiskDiscard            = flags.Bool(pveDiskDiscardParameter)
+	d.DiskIOThread           = flags.Bool(pveDiskIOThreadParameter)
+	d.DiskPreallocation      = strings.ToLower(flags.String(pveDiskPreallocationParameter))
+	d.DiskAllocTimeout       = flags.Int(pveDiskAllocTimeoutParameter)
+	d.DiskThin               = flags.Bool(pveDiskThinParameter)
+	d.InlineDisk             = flags.Bool(pveInlineDiskParameter)
+	d.ExtraDisks             = flags.StringSlice(pveExtraDiskParameter)
+	d.HostPCI                = flags.StringSlice(pveHostPCIParameter)
+	d.USB                    = flags.StringSlice(pveUSBParameter)
+	d.Bios                   = strings.ToLower(flags.String(pveBiosParameter))
+	d.MachineType            = strings.ToLower(flags.String(pveMachineTypeParameter))
+	d.OsType                 = strings.ToLower(flags.String(pveOsTypeParameter))
+	d.BootOrder              = strings.ToLower(flags.String(pveBootOrderParameter))
+	d.Vga                    = strings.ToLower(flags.String(pveVgaParameter))
+	d.Serial                 = flags.Bool(pveSerialParameter)
+	d.Hotplug                = strings.ToLower(flags.String(pveHotplugParameter))
+	d.Rng                    = flags.Bool(pveRngParameter)
+	d.QemuArgs               = flags.String(pveQemuArgsParameter)
+	d.AgentFstrim            = flags.Bool(pveAgentFstrimParameter)
+	d.AgentPingTimeout       = flags.Int(pveAgentPingTimeoutParameter)
+	d.Memory                 = memorySizeMB(flags.Int(pveMemoryGbParameter), flags.Int(pveMemoryMbParameter))
+	d.MemoryMin              = flags.Int(pveMemoryMinGbParameter)
 	d.GuestUsername          = flags.String(pveGuestUsernameParameter)
 	d.Sockets                = flags.String(pveCpuSocketsParameter)
 	d.Cores                  = flags.String(pveCpuCoresParameter)
@@ -389,26 +1143,71 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.Numa                   = flags.Bool(pveCpuNumaParamater)
 	d.Pcid                   = flags.Bool(pveCpuPcidParameter)
 	d.SpecCtrl               = flags.Bool(pveCpuSpecCtlrParameter)
+	d.CpuLimit               = flags.String(pveCpuLimitParameter)
+	d.CpuUnits               = flags.Int(pveCpuUnitsParameter)
 
 	// Optional Paramweters:
 	d.Pool                   = flags.String(pvePoolParameter)
+	d.HAGroup                = flags.String(pveHAGroupParameter)
+	d.VMName                 = flags.String(pveVmNameParameter)
+	d.RequestedVMID          = flags.String(pveVMIDParameter)
+	d.VMIDRangeMin           = flags.Int(pveVMIDRangeMinParameter)
+	d.Description            = flags.String(pveVmDescriptionParameter)
+	d.Tags                   = flags.StringSlice(pveTagParameter)
+	d.APITokenID             = flags.String(pveAPITokenIDParameter)
+	d.APITokenSecret         = flags.String(pveAPITokenSecretParameter)
+	d.InsecureTLS            = flags.Bool(pveInsecureTLSParameter)
+	d.CAFile                 = flags.String(pveCAFileParameter)
 	d.GuestPassword          = flags.String(pveGuestPasswordParameter)
 	d.NetVlanTag             = flags.Int(pveNetVlanTagParameter)
+	d.NetQueues              = flags.Int(pveNetQueuesParameter)
+	d.NetMacAddr             = strings.ToUpper(flags.String(pveNetMacAddrParameter))
+	d.NetRate                = flags.String(pveNetRateParameter)
+	d.Firewall               = flags.Bool(pveFirewallParameter)
+	d.Networks               = flags.StringSlice(pveNetParameter)
+	d.NetInterface           = flags.String(pveNetInterfaceParameter)
+	d.IPFamily               = flags.String(pveIPFamilyParameter)
 	d.GuestSSHPrivateKey     = flags.String(pveGuestSshPrivateKeyParameter)
 	d.GuestSSHPublicKey      = flags.String(pveGuestSshPublicKeyParameter)
 	d.GuestSSHAuthorizedKeys = flags.String(pveGuestSshAuthorizedKeysParameter)
+	d.SSHKeyType             = strings.ToLower(flags.String(pveSshKeyTypeParameter))
+	d.SSHKeyBits             = flags.Int(pveSshKeyBitsParameter)
+	d.SSHKeyFile             = flags.String(pveSshKeyPathParameter)
+	d.SSHKeyStorePath        = flags.String(pveSSHKeyStorePathParameter)
+	d.ReplaceAuthorizedKeys  = flags.Bool(pveReplaceAuthKeysParameter)
+	d.SSHDialTimeout         = flags.Int(pveSSHDialTimeoutParameter)
+	d.SSHHostKeyCheck        = strings.ToLower(flags.String(pveSSHHostKeyCheckParameter))
+	d.CloudInit              = flags.Bool(pveCloudInitParameter)
+	d.CloudInitStorage       = flags.String(pveCloudInitStorageParameter)
+	d.StaticIPAddress        = flags.String(pveIPAddressParameter)
+	d.StaticGateway          = flags.String(pveGatewayParameter)
+	d.StaticNetmask          = flags.String(pveNetmaskParameter)
+	d.CloneVMID              = flags.String(pveCloneVMIDParameter)
+	d.CloneFull              = flags.Bool(pveCloneFullParameter)
+	d.CloneTemplateName      = flags.String(pveCloneTemplateNameParameter)
+
+	d.ProvisionTimeout       = flags.Int(pveProvisionTimeoutParameter)
+	d.ProvisionStartDelay    = flags.Int(pveProvisionStartDelayParameter)
+	d.ProvisionScript        = flags.String(pveProvisionScriptParameter)
+	d.NoStart                = flags.Bool(pveNoStartParameter)
+	d.UpgradeCommand         = flags.String(pveUpgradeCommandParameter)
+	d.APIRetries             = flags.Int(pveAPIRetriesParameter)
+	d.DryRun                 = flags.Bool(pveDryRunParameter)
 
 	d.driverDebug            = flags.Bool(pveDriverDebugParameter)
 	d.restyDebug             = flags.Bool(pveRestyDebugParameter)
+	if d.driverDebug {
+		log.SetLevel(log.DEBUG)
+	}
 
 	d.SwarmMaster            = flags.Bool(pveSwarmMastertParameter)
 	d.SwarmHost              = flags.String(pveSwarmHostParameter)
 
 	// Adjust and other modifications on parameters
 	d.SSHUser                = d.GuestUsername
-	d.Memory                *= 1024
+	d.MemoryMin             *= 1024
 
-	d.debugf("Private key:\n%s\n\nPublic Key:\n%s\n\n", d.GuestSSHPrivateKey, d.GuestSSHPublicKey)
+	d.debugf("Private key: %d bytes, Public Key:\n%s\n\n", len(d.GuestSSHPrivateKey), d.GuestSSHPublicKey)
 
 	if d.restyDebug {
 		d.debug("enabling Resty debugging")
@@ -419,23 +1218,98 @@ func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 		d.GuestPassword = ""
 	}
 
+	if d.RootDiskStorage == "" {
+		d.RootDiskStorage = d.Storage
+	}
+	if d.CloudInitStorage == "" {
+		d.CloudInitStorage = d.Storage
+	}
+
+	onboot, err := parseBoolFlag(pveOnbootParameter, flags.String(pveOnbootParameter))
+	if err != nil {
+		return err
+	}
+	d.Onboot = onboot
+
+	agent, err := parseBoolFlag(pveAgentParameter, flags.String(pveAgentParameter))
+	if err != nil {
+		return err
+	}
+	d.NoAgent = !agent
+
+	d.AgentFreezeFs, err = parseBoolFlag(pveAgentFreezeFsParameter, flags.String(pveAgentFreezeFsParameter))
+	if err != nil {
+		return err
+	}
+
+	kvm, err := parseBoolFlag(pveKvmParameter, flags.String(pveKvmParameter))
+	if err != nil {
+		return err
+	}
+	d.KVM = kvm
+
+	d.EjectISO = d.CloudInit
+	if eject := flags.String(pveEjectISOParameter); eject != "" {
+		d.EjectISO, err = parseBoolFlag(pveEjectISOParameter, eject)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch d.IPFamily {
+	case pveIPFamilyIPv4, pveIPFamilyIPv6, pveIPFamilyAuto:
+	default:
+		return fmt.Errorf("--%s must be one of %s, %s or %s", pveIPFamilyParameter, pveIPFamilyIPv4, pveIPFamilyIPv6, pveIPFamilyAuto)
+	}
+
+	if d.ProvisionTimeout <= 0 {
+		return fmt.Errorf("--%s must be a positive number of seconds", pveProvisionTimeoutParameter)
+	}
+	if d.ProvisionStartDelay < 0 {
+		return fmt.Errorf("--%s must not be negative", pveProvisionStartDelayParameter)
+	}
+	if d.AgentPingTimeout <= 0 {
+		return fmt.Errorf("--%s must be a positive number of seconds", pveAgentPingTimeoutParameter)
+	}
+	if d.SSHDialTimeout <= 0 {
+		return fmt.Errorf("--%s must be a positive number of seconds", pveSSHDialTimeoutParameter)
+	}
+	if d.DiskAllocTimeout <= 0 {
+		return fmt.Errorf("--%s must be a positive number of seconds", pveDiskAllocTimeoutParameter)
+	}
+	if d.APIRetries < 0 {
+		return fmt.Errorf("--%s must not be negative", pveAPIRetriesParameter)
+	}
+
 	// Required parameters validations
 	if d.Host == "" {
 		return fmt.Errorf(pveDiverMissingOptionMessageFmt, pveHostParameter)
 	}
 
-	if d.Node == "" {
+	if d.Node == "" && !d.NodeAuto {
 		return fmt.Errorf(pveDiverMissingOptionMessageFmt, pveNodeParameter)
 	}
 
-	if d.Password == "" {
+	if d.APITokenID != "" {
+		if d.APITokenSecret == "" {
+			return fmt.Errorf(pveDiverMissingOptionMessageFmt, pveAPITokenSecretParameter)
+		}
+	} else if d.Password == "" {
 		return fmt.Errorf(pveDiverMissingOptionMessageFmt, pvePasswordParameter)
 	}
 
-	if d.ImageFile == "" {
+	if d.ImageFile == "" && d.CloneVMID == "" && d.CloneTemplateName == "" {
 		return fmt.Errorf(pveDiverMissingOptionMessageFmt, pveImageFileParameter)
 	}
 
+	if d.CloneVMID != "" && d.CloneTemplateName != "" {
+		return fmt.Errorf("proxmoxve driver accepts only one of --%s and --%s", pveCloneVMIDParameter, pveCloneTemplateNameParameter)
+	}
+
+	if d.StaticIPAddress != "" && !d.CloudInit {
+		return fmt.Errorf(pveDiverMissingOptionMessageFmt, pveCloudInitParameter)
+	}
+
 	return nil
 }
 
@@ -447,7 +1321,7 @@ func (d *Driver) GetURL() (string, error) {
 	if ip == "" {
 		return "", nil
 	}
-	return fmt.Sprintf("tcp://%s:2376", ip), nil
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
 }
 
 func (d *Driver) GetMachineName() string {
@@ -455,308 +1329,2615 @@ func (d *Driver) GetMachineName() string {
 }
 
 func (d *Driver) GetIP() (string, error) {
-	d.connectAPI()
-	return d.driver.GetEth0IPv4(d.Node, d.VMID)
-}
+	if d.StaticIPAddress != "" {
+		return strings.SplitN(d.StaticIPAddress, "/", 2)[0], nil
+	}
 
-func (d *Driver) GetSSHHostname() (string, error) {
-	return d.GetIP()
+	err := d.connectAPI()
+	if err != nil {
+		return "", err
+	}
+	switch d.IPFamily {
+	case pveIPFamilyIPv6:
+		return d.driver.GetInterfaceIPv6(d.Node, d.VMID, d.NetInterface)
+	case pveIPFamilyAuto:
+		ip, err := d.driver.GetInterfaceIPv4(d.Node, d.VMID, d.NetInterface)
+		if err != nil || ip != "" {
+			return ip, err
+		}
+		return d.driver.GetInterfaceIPv6(d.Node, d.VMID, d.NetInterface)
+	}
+	return d.driver.GetInterfaceIPv4(d.Node, d.VMID, d.NetInterface)
+}
+
+// GetSSHHostname returns the guest address, IPv6 literals are wrapped in brackets
+func (d *Driver) GetSSHHostname() (string, error) {
+	ip, err := d.GetIP()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(ip, ":") {
+		return "[" + ip + "]", nil
+	}
+	return ip, nil
+}
+
+// GetConfig returns the current configuration of the VM, e.g. to verify that it was created
+// as requested. Devices can be parsed with ParseQemuNetDevice and ParseQemuDiskDevice.
+func (d *Driver) GetConfig() (*NodesNodeQemuVMIDConfigReturnParameter, error) {
+	err := d.connectAPI()
+	if err != nil {
+		return nil, err
+	}
+	return d.driver.NodesNodeQemuVMIDConfigGet(d.Node, d.VMID)
+}
+
+// GetSSHKeyFingerprint returns the SHA256 fingerprint of the machine's public key, the one
+// PreCreateCheck created or copied to GetSSHKeyPath() and that is installed on the guest
+func (d *Driver) GetSSHKeyFingerprint() (string, error) {
+	pub, err := ioutil.ReadFile(d.GetSSHKeyPath() + ".pub")
+	if err != nil {
+		return "", err
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("SSH public key '%s.pub' is not valid - %s", d.GetSSHKeyPath(), err)
+	}
+	return ssh.FingerprintSHA256(key), nil
+}
+
+// GetSSHKeyPath returns the private key of the machine, in the key store path if one is given
+func (d *Driver) GetSSHKeyPath() string {
+	if d.SSHKeyStorePath != "" {
+		return path.Join(d.SSHKeyStorePath, "id_"+d.MachineName)
+	}
+	return d.BaseDriver.GetSSHKeyPath()
+}
+
+// checkKeyStorePath creates the directory for the key pair if needed and makes sure
+// that it is writable and not accessible by other users
+func checkKeyStorePath(dir string) error {
+	if !path.IsAbs(dir) {
+		// docker-machine runs later commands from other working directories
+		return fmt.Errorf("SSH key store path '%s' must be an absolute path", dir)
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("could not create the SSH key store path: %s", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("SSH key store path '%s' is not a directory", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("SSH key store path '%s' has mode %04o, it must not be accessible by other users (chmod 700)", dir, info.Mode().Perm())
+	}
+
+	probe, err := ioutil.TempFile(dir, ".write-test")
+	if err != nil {
+		return fmt.Errorf("SSH key store path '%s' is not writable: %s", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+func (d *Driver) GetSSHPort() (int, error) {
+	if d.SSHPort == 0 {
+		d.SSHPort = 22
+	}
+
+	return d.SSHPort, nil
+}
+
+func (d *Driver) GetSSHUsername() string {
+	if d.SSHUser == "" {
+		d.SSHUser = pveDefaultVmGuestUserName
+	}
+
+	return d.SSHUser
+}
+
+func (d *Driver) GetState() (state.State, error) {
+	err := d.connectAPI()
+	if err != nil {
+		return state.Error, fmt.Errorf("could not connect to Proxmox VE: %s", err)
+	}
+
+	st, err := d.driver.NodesNodeQemuVMIDStatusCurrentGet(d.Node, d.VMID)
+	if err == nil && st != state.Error {
+		return st, nil
+	}
+	d.debugf("Could not read status of VM '%s', falling back to reachability: %v", d.VMID, err)
+
+	if d.reachable() {
+		return state.Running, nil
+	}
+	if err != nil {
+		return state.Error, fmt.Errorf("could not read status of VM '%s': %s", d.VMID, err)
+	}
+	return state.Error, fmt.Errorf("VM '%s' reported an unknown status", d.VMID)
+}
+
+func (d *Driver) PreCreateCheck() error {
+
+	if d.StaticIPAddress != "" {
+		if _, err := d.ipConfig(); err != nil {
+			return err
+		}
+	}
+
+	if d.NetVlanTag < 0 || d.NetVlanTag > 4094 {
+		return fmt.Errorf("VLAN tag '%d' must be 0 (untagged) or 1 - 4094", d.NetVlanTag)
+	}
+
+	if d.NetQueues < 0 || d.NetQueues > 64 {
+		return fmt.Errorf("network queues '%d' must be 0 (unset) or 1 - 64", d.NetQueues)
+	}
+	if d.NetQueues > 0 && d.NetModel != "virtio" {
+		return fmt.Errorf("--%s is only supported with the virtio network model, not '%s'", pveNetQueuesParameter, d.NetModel)
+	}
+
+	if d.NetMacAddr != "" && !pveMacAddrRegexp.MatchString(d.NetMacAddr) {
+		return fmt.Errorf("MAC address '%s' is not a valid unicast address", d.NetMacAddr)
+	}
+
+	if d.NetRate != "" {
+		rate, err := strconv.ParseFloat(d.NetRate, 64)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("--%s must be a positive number of MB/s, got '%s'", pveNetRateParameter, d.NetRate)
+		}
+	}
+
+	if d.NoAgent && d.AgentFstrim {
+		return fmt.Errorf("--%s requires the guest agent", pveAgentFstrimParameter)
+	}
+
+	if d.NoAgent && d.StaticIPAddress == "" {
+		return fmt.Errorf("the IP address cannot be discovered without the guest agent, --%s is required", pveIPAddressParameter)
+	}
+
+	if len(d.HostPCI) > pveMaxVmHostPCI {
+		return fmt.Errorf("at most %d PCI devices can be passed through, got %d", pveMaxVmHostPCI, len(d.HostPCI))
+	}
+	for _, dev := range d.HostPCI {
+		if !pveHostPCIRegexp.MatchString(dev) {
+			return fmt.Errorf("PCI device '%s' of --%s is not valid", dev, pveHostPCIParameter)
+		}
+	}
+	// clones keep the firmware of the template, which has to be OVMF then
+	cloning := d.CloneVMID != "" || d.CloneTemplateName != ""
+	if len(d.HostPCI) > 0 && (!strings.Contains(d.MachineType, "q35") || (d.Bios != "ovmf" && !cloning)) {
+		return fmt.Errorf("PCI passthrough requires --%s q35 and --%s ovmf", pveMachineTypeParameter, pveBiosParameter)
+	}
+
+	if len(d.USB) > pveMaxVmUSB {
+		return fmt.Errorf("at most %d USB devices can be passed through, got %d", pveMaxVmUSB, len(d.USB))
+	}
+	for _, dev := range d.USB {
+		if !pveUSBRegexp.MatchString(dev) {
+			return fmt.Errorf("USB device '%s' of --%s is not valid, use host=<vendor>:<product> or host=<bus>-<port>", dev, pveUSBParameter)
+		}
+	}
+
+	if err := d.checkNetworks(); err != nil {
+		return err
+	}
+	if err := d.checkCloneFlags(); err != nil {
+		return err
+	}
+
+	switch d.StorageType {
+	case "":
+		// chosen in PreCreateCheck once the type of the storage is known
+	case "raw":
+		fallthrough
+	case "qcow2":
+		break
+	default:
+		return fmt.Errorf("storage type '%s' is not supported", d.StorageType)
+	}
+
+	switch d.DiskBus {
+	case "scsi", "virtio", "sata", "ide":
+		break
+	default:
+		return fmt.Errorf("disk bus '%s' is not supported", d.DiskBus)
+	}
+
+	switch d.DiskCache {
+	case "", "none", "writeback", "writethrough", "directsync", "unsafe":
+		break
+	default:
+		return fmt.Errorf("disk cache mode '%s' is not supported", d.DiskCache)
+	}
+
+	switch d.DiskPreallocation {
+	case "", "off", "metadata", "falloc", "full":
+		break
+	default:
+		return fmt.Errorf("disk preallocation '%s' is not supported", d.DiskPreallocation)
+	}
+
+	if d.DiskSSD && d.DiskBus == "virtio" {
+		return fmt.Errorf("SSD emulation is not supported on disk bus '%s'", d.DiskBus)
+	}
+
+	if d.DiskIOThread && d.DiskBus != "scsi" && d.DiskBus != "virtio" {
+		return fmt.Errorf("IO threads are not supported on disk bus '%s', only on scsi and virtio", d.DiskBus)
+	}
+
+	if _, err := d.extraDisks(); err != nil {
+		return err
+	}
+
+	switch d.Bios {
+	case "seabios", "ovmf":
+		break
+	default:
+		return fmt.Errorf("bios '%s' is not supported", d.Bios)
+	}
+
+	switch d.OsType {
+	case "l26", "l24", "win11", "win10", "win8", "win7", "wvista", "w2k8", "w2k3", "w2k", "wxp", "solaris", "other":
+		break
+	default:
+		return fmt.Errorf("OS type '%s' is not supported", d.OsType)
+	}
+
+	if err := d.checkDisplay(); err != nil {
+		return err
+	}
+
+	if d.Hotplug != "" && d.Hotplug != "0" && d.Hotplug != "1" {
+		for _, hotplug := range strings.Split(d.Hotplug, ",") {
+			switch hotplug {
+			case "disk", "network", "usb", "cpu", "cloudinit":
+				break
+			case "memory":
+				// memory hotplug works on NUMA nodes only
+				if !d.Numa {
+					return fmt.Errorf("memory hotplug requires --%s", pveCpuNumaParamater)
+				}
+			default:
+				return fmt.Errorf("hotplug type '%s' is not supported", hotplug)
+			}
+		}
+	}
+
+	if d.BootOrder != "" {
+		for _, dev := range strings.Split(d.BootOrder, ";") {
+			if !pveBootDeviceRegexp.MatchString(dev) {
+				return fmt.Errorf("boot device '%s' of --%s is not valid", dev, pveBootOrderParameter)
+			}
+		}
+	}
+
+	switch d.SSHKeyType {
+	case "rsa", "ed25519":
+		break
+	default:
+		return fmt.Errorf("SSH key type '%s' is not supported", d.SSHKeyType)
+	}
+	if d.SSHKeyType == "rsa" && d.SSHKeyBits < 2048 {
+		return fmt.Errorf("RSA keys must have at least 2048 bits, got %d", d.SSHKeyBits)
+	}
+
+	if d.ProvisionScript != "" {
+		if _, err := os.Stat(d.ProvisionScript); err != nil {
+			return fmt.Errorf("could not read the provision script: %s", err)
+		}
+	}
+
+	switch d.SSHHostKeyCheck {
+	case "", pveSSHHostKeyIgnore, pveSSHHostKeyPin:
+		break
+	default:
+		return fmt.Errorf("SSH host key check '%s' is not supported, use %s or %s", d.SSHHostKeyCheck, pveSSHHostKeyIgnore, pveSSHHostKeyPin)
+	}
+
+	if err := checkIntRange(pveCpuSocketsParameter, d.Sockets, 1, 4); err != nil {
+		return err
+	}
+	if err := checkIntRange(pveCpuCoresParameter, d.Cores, 1, 128); err != nil {
+		return err
+	}
+	if d.Sockets != "1" && !d.Numa {
+		d.warnf("VM has %s CPU sockets but NUMA is disabled, pass --%s for better memory locality", d.Sockets, pveCpuNumaParamater)
+	}
+
+	if d.MemoryMin < 0 || d.MemoryMin > d.Memory {
+		return fmt.Errorf("minimum memory of %d MB must be between 0 and the memory of %d MB", d.MemoryMin, d.Memory)
+	}
+
+	if d.CpuType != "" && !pveCpuTypeRegexp.MatchString(d.CpuType) {
+		return fmt.Errorf("CPU type '%s' is not valid", d.CpuType)
+	}
+	if !d.KVM && strings.HasPrefix(d.CpuType, "host") {
+		return fmt.Errorf("CPU type 'host' requires KVM, it can not be used with --%s false", pveKvmParameter)
+	}
+
+	if d.CpuLimit != "" {
+		limit, err := strconv.ParseFloat(d.CpuLimit, 64)
+		if err != nil || limit < 0 || limit > 128 {
+			return fmt.Errorf("--%s must be a number of cores between 0 and 128, got '%s'", pveCpuLimitParameter, d.CpuLimit)
+		}
+	}
+	if d.CpuUnits < 0 {
+		return fmt.Errorf("--%s must be a positive weight, got %d", pveCpuUnitsParameter, d.CpuUnits)
+	}
+
+	if d.MachineType != "" && !pveMachineTypeRegexp.MatchString(d.MachineType) {
+		return fmt.Errorf("machine type '%s' is not valid", d.MachineType)
+	}
+
+	if d.VMName != "" && !pveDNSNameRegexp.MatchString(d.VMName) {
+		return fmt.Errorf("VM name '%s' is not a valid DNS name", d.VMName)
+	}
+
+	if d.RequestedVMID != "" {
+		if err := checkIntRange(pveVMIDParameter, d.RequestedVMID, pveMinVMID, pveMaxVMID); err != nil {
+			return err
+		}
+		if d.VMIDRangeMin != 0 {
+			return fmt.Errorf("proxmoxve driver accepts only one of --%s and --%s", pveVMIDParameter, pveVMIDRangeMinParameter)
+		}
+	}
+	if d.VMIDRangeMin != 0 && (d.VMIDRangeMin < pveMinVMID || d.VMIDRangeMin > pveMaxVMID) {
+		return fmt.Errorf("--%s must be between %d and %d, got '%d'", pveVMIDRangeMinParameter, pveMinVMID, pveMaxVMID, d.VMIDRangeMin)
+	}
+
+	// Proxmox VE rejects args from any other user, including API tokens of root@pam
+	if d.QemuArgs != "" && (d.APITokenID != "" || d.User != "root" || d.Realm != "pam") {
+		return fmt.Errorf("--%s can only be used when logged in as root@pam with a password", pveQemuArgsParameter)
+	}
+
+	for _, tag := range d.Tags {
+		if !pveTagRegexp.MatchString(tag) {
+			return fmt.Errorf("tag '%s' may only contain lowercase letters, digits, '-', '_' and '.'", tag)
+		}
+	}
+
+	err := d.connectAPI()
+	if err != nil {
+		return err
+	}
+
+	caps := d.driver.GetCapabilities()
+	if d.CpuUnits > 0 {
+		err = checkCpuUnits(d.CpuUnits, caps)
+		if err != nil {
+			return err
+		}
+	}
+	err = d.checkCapabilities(caps)
+	if err != nil {
+		return err
+	}
+
+	if d.NodeAuto {
+		d.debug("Selecting the node with the most free memory")
+		d.Node, err = d.driver.FindNodeWithMostFreeMemory()
+		if err != nil {
+			return err
+		}
+		d.debugf("Selected node '%s'", d.Node)
+	}
+
+	if d.Pool != "" {
+		err = d.checkPool()
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HAGroup != "" {
+		err = d.checkHAGroup()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.checkStorages()
+	if err != nil {
+		return err
+	}
+
+	if d.ImageFile != "" && d.CloneVMID == "" && d.CloneTemplateName == "" {
+		err = d.checkImageFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = d.findExistingVM()
+	if err != nil {
+		return err
+	}
+	if !d.adopted {
+		err = d.prepareNewVM()
+		if err != nil {
+			return err
+		}
+	}
+
+	// create and save a new SSH key pair or copy the given one
+	keyfile := d.GetSSHKeyPath()
+	keypath := path.Dir(keyfile)
+	if d.SSHKeyStorePath != "" {
+		err = checkKeyStorePath(d.SSHKeyStorePath)
+	} else {
+		err = os.MkdirAll(keypath, 0755)
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.SSHKeyFile != "" {
+		d.debugf("Using existing key pair '%s'", d.SSHKeyFile)
+		pub, priv, err := ReadKeyPair(d.SSHKeyFile)
+		if err != nil {
+			return err
+		}
+		return writeKeyPair(keyfile, pub, priv)
+	}
+
+	d.debugf("Generating new key pair at path '%s'", keypath)
+	_, _, err = GetKeyPair(keyfile, d.SSHKeyType, d.SSHKeyBits)
+
+	return err
+}
+
+// findExistingVM adopts the VM of an earlier, failed create of this machine, so a
+// retried create continues with it instead of creating a second VM with the same name
+func (d *Driver) findExistingVM() error {
+	d.debugf("Looking for an existing VM named '%s'", d.vmName())
+	vmid, err := d.driver.FindVMIDByName(d.Node, d.vmName())
+	if _, ok := err.(*vmNotFoundError); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	config, err := d.driver.NodesNodeQemuVMIDConfigGet(d.Node, vmid)
+	if err != nil {
+		return err
+	}
+	// Proxmox VE stores the description as a comment and may add a newline
+	if strings.TrimSpace(config.Description) != strings.TrimSpace(d.description()) {
+		return fmt.Errorf("a VM named '%s' (VMID %s) already exists on node '%s' and was not created for machine '%s'",
+			d.vmName(), vmid, d.Node, d.MachineName)
+	}
+	if d.RequestedVMID != "" && d.RequestedVMID != vmid {
+		return fmt.Errorf("VM '%s' of an earlier create has VMID %s, not the requested %s", d.vmName(), vmid, d.RequestedVMID)
+	}
+
+	log.Infof("Adopting VM '%s' (VMID %s) left by an earlier create of machine '%s'", d.vmName(), vmid, d.MachineName)
+	d.VMID = vmid
+	d.adopted = true
+	return nil
+}
+
+// reserveVMID sets the VMID of the new VM, the requested one if it is free or the next free one
+func (d *Driver) reserveVMID() error {
+	if d.RequestedVMID != "" {
+		d.debugf("Checking that VMID '%s' is free", d.RequestedVMID)
+		exists, err := d.driver.VMIDExists(d.RequestedVMID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("VMID %s is already in use, choose another --%s or leave it empty", d.RequestedVMID, pveVMIDParameter)
+		}
+		d.VMID = d.RequestedVMID
+		return nil
+	}
+
+	if d.VMIDRangeMin != 0 {
+		id, err := d.nextFreeVMID(d.VMIDRangeMin)
+		if err != nil {
+			return err
+		}
+		d.debugf("First free ID at or above %d is '%s'", d.VMIDRangeMin, id)
+		d.VMID = id
+		return nil
+	}
+
+	d.debug("Retrieving next ID")
+	id, err := d.driver.ClusterNextIDGet(0)
+	if err != nil {
+		return err
+	}
+	d.debugf("Next ID was '%s'", id)
+	d.VMID = id
+	return nil
+}
+
+// nextFreeVMID returns the first VMID at or above min that is neither used in the cluster
+// nor refused by /cluster/nextid, which also knows IDs that are being created right now
+func (d *Driver) nextFreeVMID(min int) (string, error) {
+	resources, err := d.driver.ClusterResourcesGet("vm")
+	if err != nil {
+		return "", err
+	}
+	used := map[int]bool{}
+	for _, resource := range resources {
+		used[resource.VMID] = true
+	}
+
+	for id := min; id <= pveMaxVMID; id++ {
+		if used[id] {
+			continue
+		}
+		vmid, err := d.driver.ClusterNextIDGet(id)
+		if vmidInUse(err) {
+			d.debugf("VMID %d is not available: %s", id, err)
+			continue
+		}
+		return vmid, err
+	}
+	return "", fmt.Errorf("no free VMID at or above %d", min)
+}
+
+// prepareNewVM reserves the VMID and checks the storage for a VM that is created from scratch
+func (d *Driver) prepareNewVM() error {
+	err := d.reserveVMID()
+	if err != nil {
+		return err
+	}
+
+	storageType, err := d.driver.GetStorageType(d.Node, d.RootDiskStorage)
+	if err != nil {
+		return err
+	}
+
+	err = d.checkStorageFormat(storageType)
+	if err != nil {
+		return err
+	}
+	if d.InlineDisk && d.DiskPreallocation != "" {
+		d.warnf("The root disk is allocated by Proxmox VE with --%s, ignoring --%s", pveInlineDiskParameter, pveDiskPreallocationParameter)
+	} else if d.DiskPreallocation != "" && storageType != "dir" {
+		d.warnf("Storage '%s' of type '%s' does not use disk files, ignoring --%s", d.RootDiskStorage, storageType, pveDiskPreallocationParameter)
+	}
+	if d.DiskThin {
+		err = d.checkThinProvisioning(storageType)
+		if err != nil {
+			return err
+		}
+	}
+
+	d.StorageFilename = d.diskFilename(storageType, 0)
+
+	return d.checkStorageSpace()
+}
+
+func (d *Driver) Create() error {
+	var err error
+	if d.adopted {
+		err = d.resumeAdoptedVM()
+	} else {
+		err = d.createAndStartVM()
+	}
+	if err == errDryRun {
+		// the ID was only looked up, it must not point Remove at a VM this machine did not create
+		d.VMID = ""
+		d.adopted = false
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.NoStart {
+		d.ProvisionPending = true
+		log.Infof("Created VM '%s' without starting it, it is provisioned on the first start", d.VMID)
+		return nil
+	}
+	return d.provisionGuest()
+}
+
+// provisionGuest waits for the running VM, installs the SSH key unless cloud-init did and runs the provision script
+func (d *Driver) provisionGuest() error {
+	var err error
+	if d.CloudInit {
+		// keys have been installed by cloud-init, only the address is missing
+		d.IPAddress, err = d.waitForIP()
+		if err != nil {
+			return err
+		}
+
+		if d.ProvisionScript != "" {
+			err = d.runProvisionScriptWithKey()
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		err = d.waitAndPrepareSSH()
+		if err != nil {
+			return err
+		}
+
+		// the agent may answer before the network is fully up, do not return
+		// until the address the next docker-machine steps rely on is reported
+		d.IPAddress, err = d.waitForIP()
+		if err != nil {
+			return err
+		}
+	}
+
+	fingerprint, err := d.GetSSHKeyFingerprint()
+	if err != nil {
+		return err
+	}
+	log.Infof("Installed SSH key '%s' with fingerprint %s", d.GetSSHKeyPath(), fingerprint)
+
+	if d.EjectISO && d.CloneVMID == "" {
+		return d.ejectISO()
+	}
+	return nil
+}
+
+// createAndStartVM creates the VM from the image file or template, registers it and starts it
+func (d *Driver) createAndStartVM() error {
+	var err error
+	if d.CloneTemplateName != "" {
+		d.debugf("Resolving template '%s'", d.CloneTemplateName)
+		d.CloneVMID, err = d.driver.FindVMIDByName(d.Node, d.CloneTemplateName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.CloneVMID != "" {
+		err = d.cloneVM()
+	} else {
+		err = d.createVM()
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.Firewall {
+		// firewall=1 on the NIC has no effect until the firewall of the VM itself is enabled
+		d.debugf("Enabling firewall of VM '%s'", d.VMID)
+		options := NodesNodeQemuVMIDFirewallOptionsPutParameter{Enable: true}
+		err = d.driver.NodesNodeQemuVMIDFirewallOptionsPut(d.Node, d.VMID, &options)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HAGroup != "" {
+		d.debugf("Adding VM '%s' to HA group '%s'", d.VMID, d.HAGroup)
+		resource := ClusterHAResourcesPostParameter{
+			Sid:     d.haResourceID(),
+			Group:   d.HAGroup,
+			State:   d.haState(),
+			Comment: d.description(),
+		}
+		err = d.driver.ClusterHAResourcesPost(&resource)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.NoStart {
+		return nil
+	}
+	return d.Start()
+}
+
+// haState returns the state the HA manager keeps the VM in, a started resource would be started right away
+func (d *Driver) haState() string {
+	if d.NoStart {
+		return "stopped"
+	}
+	return "started"
+}
+
+// resumeAdoptedVM starts an adopted VM unless it is running already, its hardware
+// was set up by the create that left it behind
+func (d *Driver) resumeAdoptedVM() error {
+	if d.DryRun {
+		log.Infof("Dry run, would continue provisioning VM '%s' on node '%s'", d.VMID, d.Node)
+		return errDryRun
+	}
+
+	st, err := d.GetState()
+	if err != nil {
+		return err
+	}
+	if st == state.Running || d.NoStart {
+		return nil
+	}
+	return d.Start()
+}
+
+// checkPool makes sure the pool exists, otherwise creating the VM fails after the disk is allocated
+func (d *Driver) checkPool() error {
+	d.debugf("Looking up pool '%s'", d.Pool)
+	pools, err := d.driver.PoolsGet()
+	if err != nil {
+		return err
+	}
+
+	available := []string{}
+	for _, pool := range pools {
+		if pool.Poolid == d.Pool {
+			return nil
+		}
+		available = append(available, pool.Poolid)
+	}
+	if len(available) == 0 {
+		return fmt.Errorf("pool '%s' not found, no pools are available", d.Pool)
+	}
+	return fmt.Errorf("pool '%s' not found, available pools: %s", d.Pool, strings.Join(available, ", "))
+}
+
+// checkHAGroup makes sure the HA group exists before the VM is created
+func (d *Driver) checkHAGroup() error {
+	d.debugf("Looking up HA group '%s'", d.HAGroup)
+	groups, err := d.driver.ClusterHAGroupsGet()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if group.Group == d.HAGroup {
+			return nil
+		}
+	}
+	return fmt.Errorf("HA group '%s' not found", d.HAGroup)
+}
+
+// haResourceID returns the ID of the VM in the HA manager
+func (d *Driver) haResourceID() string {
+	return "vm:" + d.VMID
+}
+
+// checkImageFile makes sure the image file is uploaded, otherwise the VM would boot into nothing
+func (d *Driver) checkImageFile() error {
+	parts := strings.SplitN(d.ImageFile, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("image file '%s' is not in the format <storagename>:iso/<filename>.iso", d.ImageFile)
+	}
+	storage := parts[0]
+
+	d.debugf("Looking up image file '%s' on storage '%s'", d.ImageFile, storage)
+	exists, err := d.driver.StorageContentExists(d.Node, storage, d.ImageFile)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("image file '%s' not found on storage '%s'", d.ImageFile, storage)
+	}
+	return nil
+}
+
+// ejectISO removes the boot image from the virtual CD drive once the VM is provisioned
+func (d *Driver) ejectISO() error {
+	config := NodesNodeQemuVMIDConfigPostParameter{
+		Devices: map[string]string{d.isoKey(): "none,media=cdrom"},
+	}
+	d.debugf("Ejecting '%s' from '%s' of VM '%s'", d.ImageFile, d.isoKey(), d.VMID)
+	taskid, err := d.driver.NodesNodeQemuVMIDConfigPost(d.Node, d.VMID, &config)
+	if err != nil {
+		return err
+	}
+	return d.waitForTask(taskid)
+}
+
+// createVM allocates the root disk and creates a new VM booting from the image file
+func (d *Driver) createVM() (err error) {
+	volume := NodesNodeStorageStorageContentPostParameter{
+		Filename:      d.StorageFilename,
+		Size:          d.DiskSize + "G",
+		VMID:          d.VMID,
+		Preallocation: d.diskPreallocation(d.StorageFilename),
+	}
+
+	// volumes allocated so far, they are removed again if the VM can not be created
+	allocated := []storageVolume{}
+	defer func() {
+		if err != nil {
+			d.removeVolumes(allocated)
+		}
+	}()
+
+	var storageDrive string
+	if d.InlineDisk {
+		// Proxmox VE allocates a new volume of the size in GB and owns it like the EFI disk
+		storageDrive = d.diskConfig(fmt.Sprintf("%s:%s,format=%s", d.RootDiskStorage, d.DiskSize, d.StorageType))
+	} else {
+		d.debugf("Creating disk volume '%s' with size '%s'", volume.Filename, volume.Size)
+		_, err = d.allocateVolume(d.RootDiskStorage, &volume)
+		if err != nil {
+			return err
+		}
+		allocated = append(allocated, storageVolume{d.RootDiskStorage, volume.Filename})
+
+		storageDrive = d.diskConfig(fmt.Sprintf("%s:%s,size=%s", d.RootDiskStorage, volume.Filename, volume.Size))
+	}
+
+	numa := 0
+	if d.Numa {
+		numa = 1
+	}
+
+	npp := NodesNodeQemuPostParameter{
+		VMID:        d.VMID,
+		Memory:      d.Memory,
+		Balloon:     d.balloonConfig(),
+		Autostart:   pveDefaultVmAutoStart,
+		Agent:       d.agentConfig(),
+		Name:        d.vmName(),
+		Description: d.description(),
+		Tags:        strings.Join(d.Tags, ";"),
+		Boot:        d.bootConfig(),
+		Bootdisk:    d.rootDiskKey(),
+		Devices:     map[string]string{d.rootDiskKey(): storageDrive},
+		Onboot:      d.Onboot,
+		Ostype:      d.OsType,
+		KVM:         boolParam(d.KVM), // in a nested environment without nested virtualization this has to be 0
+		Pool:        d.Pool,
+		Sockets:     d.Sockets,
+		Cores:       d.Cores,
+		Cdrom:       d.ImageFile,
+		CPU:         d.cpuConfig(),
+		Cpulimit:    d.cpuLimitConfig(),
+		Cpuunits:    d.cpuUnitsConfig(),
+		Numa:        numa,
+		Machine:     d.MachineType,
+		Vga:         d.Vga,
+		Serial0:     d.serialConfig(),
+		Hotplug:     d.Hotplug,
+		Rng0:        d.rngConfig(),
+		Args:        d.QemuArgs,
+	}
+
+	for i, net := range d.netConfigs() {
+		switch i {
+		case 0:
+			npp.Net0 = net
+		case 1:
+			npp.Net1 = net
+		case 2:
+			npp.Net2 = net
+		case 3:
+			npp.Net3 = net
+		}
+	}
+
+	if d.CloudInit {
+		sshKeys, err := d.cloudInitSSHKeys()
+		if err != nil {
+			return err
+		}
+
+		npp.Cdrom = ""
+		npp.Devices[d.isoKey()] = d.ImageFile + ",media=cdrom"
+		npp.CloudInit = fmt.Sprintf("%s:cloudinit", d.CloudInitStorage)
+		npp.Citype = pveDefaultVmCloudInitType
+		npp.Ciupgrade = d.ciUpgrade()
+		npp.Ciuser = d.GuestUsername
+		npp.Cipassword = d.GuestPassword
+		npp.SshKeys = sshKeys
+
+		if d.StaticIPAddress != "" {
+			npp.Ipconfig0, err = d.ipConfig()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	disks, err := d.extraDisks()
+	if err != nil {
+		return err
+	}
+	for i, disk := range disks {
+		key, err := nextDiskKey(disk.bus, npp.Devices)
+		if err != nil {
+			return err
+		}
+
+		storageType, err := d.driver.GetStorageType(d.Node, disk.storage)
+		if err != nil {
+			return err
+		}
+		extra := NodesNodeStorageStorageContentPostParameter{
+			Filename: d.diskFilename(storageType, i+1),
+			Size:     disk.size,
+			VMID:     d.VMID,
+		}
+		extra.Preallocation = d.diskPreallocation(extra.Filename)
+
+		d.debugf("Creating extra disk volume '%s' with size '%s' on storage '%s'", extra.Filename, extra.Size, disk.storage)
+		volid, err := d.allocateVolume(disk.storage, &extra)
+		if err != nil {
+			return err
+		}
+		allocated = append(allocated, storageVolume{disk.storage, volid})
+		npp.Devices[key] = volid
+	}
+
+	for key, dev := range d.passthroughDevices() {
+		npp.Devices[key] = dev
+	}
+
+	if d.StorageType == "qcow2" && !d.InlineDisk {
+		npp.Devices[d.rootDiskKey()] = d.diskConfig(d.RootDiskStorage + ":" + d.VMID + "/" + volume.Filename)
+	}
+	if hasSCSIDevice(npp.Devices) {
+		// without it Proxmox VE falls back to the LSI controller, also for extra disks on scsi
+		npp.Scsihw = d.scsiHw()
+	}
+	if d.Bios == "ovmf" {
+		// Proxmox VE allocates the EFI vars disk from the OVMF template and
+		// owns it like every other VM disk, so it is removed together with the VM
+		npp.Bios = d.Bios
+		npp.Efidisk0 = fmt.Sprintf("%s:1", d.Storage)
+	}
+	if d.DryRun {
+		return d.dryRun(fmt.Sprintf("create VM '%s'", d.VMID), &npp)
+	}
+	d.debugf("Creating VM '%s' with '%d' of memory", npp.VMID, npp.Memory)
+	taskid, err := d.driver.NodesNodeQemuPost(d.Node, &npp)
+	if err != nil {
+		return err
+	}
+	err = d.waitForTask(taskid)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// vmName returns the name of the VM in Proxmox VE, the machine name if none was given
+func (d *Driver) vmName() string {
+	if d.VMName != "" {
+		return d.VMName
+	}
+	return d.MachineName
+}
+
+// description returns the VM description, a note naming the machine if none was given
+func (d *Driver) description() string {
+	if d.Description != "" {
+		return d.Description
+	}
+	return fmt.Sprintf("Created by docker-machine: %s", d.MachineName)
+}
+
+// waitForTask waits for an asynchronous API task to finish successfully
+func (d *Driver) waitForTask(taskid string) error {
+	if taskid == "" {
+		return nil
+	}
+	d.debugf("Waiting for task '%s'", taskid)
+	return d.driver.WaitForTask(d.Node, taskid, time.Duration(d.ProvisionTimeout)*time.Second)
+}
+
+// diskAllocTimeout returns how long the allocation of a single volume may take
+func (d *Driver) diskAllocTimeout() time.Duration {
+	if d.DiskAllocTimeout <= 0 {
+		return pveDefaultDiskAllocTimeout * time.Second
+	}
+	return time.Duration(d.DiskAllocTimeout) * time.Second
+}
+
+// allocateVolume allocates a disk volume and returns its volume id, a dry run only returns the id
+func (d *Driver) allocateVolume(storage string, volume *NodesNodeStorageStorageContentPostParameter) (string, error) {
+	if d.DryRun {
+		return storage + ":" + volume.Filename, nil
+	}
+
+	timeout := d.diskAllocTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	volid, err := d.driver.NodesNodeStorageStorageContentPost(ctx, d.Node, storage, volume)
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("allocating disk volume '%s' on storage '%s' took longer than %s (see --%s), "+
+			"Proxmox VE may still create it", volume.Filename, storage, timeout, pveDiskAllocTimeoutParameter)
+	}
+	return volid, err
+}
+
+// errDryRun stops Create after the parameters were logged, docker-machine would provision the machine otherwise
+var errDryRun = errors.New("dry run, no VM was created")
+
+// dryRun logs the parameters the API would be called with
+func (d *Driver) dryRun(action string, input interface{}) error {
+	params, err := json.MarshalIndent(d.driver.structToStringMap(input), "", "  ")
+	if err != nil {
+		return err
+	}
+	log.Infof("Dry run, would %s on node '%s' with:\n%s", action, d.Node, params)
+	return errDryRun
+}
+
+// removeVolumes deletes the given volumes, errors are only logged as this is used for cleaning up
+func (d *Driver) removeVolumes(volumes []storageVolume) {
+	if d.DryRun {
+		// nothing was allocated
+		return
+	}
+	for _, v := range volumes {
+		d.debugf("Removing disk volume '%s' on storage '%s'", v.volume, v.storage)
+		if err := d.driver.NodesNodeStorageStorageContentDelete(d.Node, v.storage, v.volume); err != nil {
+			d.errorf("Could not remove disk volume '%s' on storage '%s', remove it manually: %s", v.volume, v.storage, err)
+		}
+	}
+}
+
+// cloneVM creates the VM as a copy of an existing template and adjusts its hardware
+func (d *Driver) cloneVM() error {
+	clone := NodesNodeQemuVMIDClonePostParameter{
+		Newid: d.VMID,
+		Name:  d.vmName(),
+		Pool:  d.Pool,
+		Full:  d.CloneFull,
+	}
+	if d.CloneFull {
+		// a target storage is only allowed for full clones
+		clone.Storage = d.RootDiskStorage
+	}
+
+	if d.DryRun {
+		return d.dryRun(fmt.Sprintf("clone template '%s' to VM '%s'", d.CloneVMID, d.VMID), &clone)
+	}
+	d.debugf("Cloning template '%s' to VM '%s'", d.CloneVMID, d.VMID)
+	taskid, err := d.driver.NodesNodeQemuVMIDClonePost(d.Node, d.CloneVMID, &clone)
+	if err != nil {
+		return err
+	}
+	err = d.waitForTask(taskid)
+	if err != nil {
+		return err
+	}
+
+	config, err := d.cloneConfig()
+	if err != nil {
+		return err
+	}
+
+	d.debugf("Configuring VM '%s' with '%s' MB of memory", d.VMID, config.Memory)
+	taskid, err = d.driver.NodesNodeQemuVMIDConfigPost(d.Node, d.VMID, &config)
+	if err != nil {
+		return err
+	}
+	err = d.waitForTask(taskid)
+	if err != nil {
+		return err
+	}
+
+	return d.growRootDisk()
+}
+
+// cloneConfig returns the settings applied to a fresh clone, flags left at their
+// defaults keep the settings of the template
+func (d *Driver) cloneConfig() (config NodesNodeQemuVMIDConfigPostParameter, err error) {
+	config = NodesNodeQemuVMIDConfigPostParameter{
+		Memory:      strconv.Itoa(d.Memory),
+		Balloon:     d.balloonConfig(),
+		Sockets:     d.Sockets,
+		Cores:       d.Cores,
+		Cpulimit:    d.cpuLimitConfig(),
+		Cpuunits:    d.cpuUnitsConfig(),
+		Description: d.description(),
+		Tags:        strings.Join(d.Tags, ";"),
+		Onboot:      boolParam(d.Onboot),
+		Agent:       d.agentConfig(),
+		Vga:         d.Vga,
+		Serial0:     d.serialConfig(),
+		Hotplug:     d.Hotplug,
+		Rng0:        d.rngConfig(),
+		Args:        d.QemuArgs,
+		Devices:     d.passthroughDevices(),
+		CPU:         d.cpuConfig(),
+	}
+	if d.cloneNetConfigured() {
+		for i, net := range d.netConfigs() {
+			switch i {
+			case 0:
+				config.Net0 = net
+			case 1:
+				config.Net1 = net
+			case 2:
+				config.Net2 = net
+			case 3:
+				config.Net3 = net
+			}
+		}
+	}
+	if d.Numa {
+		config.Numa = "1"
+	}
+	if !d.KVM {
+		config.KVM = "0"
+	}
+	if d.MachineType != pveDefaultVmMachineType {
+		config.Machine = d.MachineType
+	}
+	if d.OsType != pveDefaultVmOsType {
+		config.Ostype = d.OsType
+	}
+	if d.CloudInit {
+		config.Ciuser = d.GuestUsername
+		config.Cipassword = d.GuestPassword
+		config.Ciupgrade = d.ciUpgrade()
+		config.SshKeys, err = d.cloudInitSSHKeys()
+		if err != nil {
+			return config, err
+		}
+		if d.StaticIPAddress != "" {
+			config.Ipconfig0, err = d.ipConfig()
+			if err != nil {
+				return config, err
+			}
+		}
+	}
+	return config, nil
+}
+
+// cloneNetConfigured reports whether any network flag differs from its default,
+// otherwise the clone keeps the network interfaces of the template
+func (d *Driver) cloneNetConfigured() bool {
+	return len(d.Networks) > 0 || d.NetBridge != pveDefaultVmNetBridge || d.NetModel != pveDefaultVmNetModel ||
+		d.NetVlanTag > 0 || d.NetQueues > 0 || d.NetMacAddr != "" || d.NetRate != "" || d.Firewall
+}
+
+// checkCloneFlags rejects flags that only shape a VM created from scratch, a clone gets
+// its firmware and disks from the template
+func (d *Driver) checkCloneFlags() error {
+	if d.CloneVMID == "" && d.CloneTemplateName == "" {
+		return nil
+	}
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{pveBiosParameter, d.Bios != pveDefaultVmBios},
+		{pveDiskCacheParameter, d.DiskCache != ""},
+		{pveDiskSSDParameter, d.DiskSSD},
+		{pveDiskDiscardParameter, d.DiskDiscard},
+		{pveDiskIOThreadParameter, d.DiskIOThread},
+		{pveExtraDiskParameter, len(d.ExtraDisks) > 0},
+	} {
+		if flag.set {
+			return fmt.Errorf("--%s can not be used for clones, the template defines it", flag.name)
+		}
+	}
+	return nil
+}
+
+// growRootDisk grows the root disk of a clone to DiskSize, the API cannot shrink disks
+// so a template with a bigger disk is an error
+func (d *Driver) growRootDisk() error {
+	requested, err := strconv.ParseInt(d.DiskSize, 10, 64)
+	if err != nil {
+		return fmt.Errorf("disk size '%s' is not a number of GB", d.DiskSize)
+	}
+	requested <<= 30
+
+	config, err := d.driver.NodesNodeQemuVMIDConfigGet(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+	key := d.rootDiskKey()
+	device := config.Disk(key)
+	if device == "" {
+		return fmt.Errorf("VM '%s' has no disk '%s' to resize", d.VMID, key)
+	}
+	current, err := ParseQemuDiskDevice(device).SizeBytes()
+	if err != nil {
+		return err
+	}
+	if requested < current {
+		return fmt.Errorf("disk '%s' of the template is %dG, bigger than the requested %sG, disks cannot be shrunk", key, current>>30, d.DiskSize)
+	}
+	if requested == current {
+		d.debugf("Disk '%s' of VM '%s' already has %sG", key, d.VMID, d.DiskSize)
+		return nil
+	}
+
+	resize := NodesNodeQemuVMIDResizePutParameter{
+		Disk: key,
+		Size: fmt.Sprintf("+%dM", (requested-current)>>20),
+	}
+	d.debugf("Growing disk '%s' of VM '%s' by '%s'", resize.Disk, d.VMID, resize.Size)
+	taskid, err := d.driver.NodesNodeQemuVMIDResizePut(d.Node, d.VMID, &resize)
+	if err != nil {
+		return err
+	}
+	return d.waitForTask(taskid)
+}
+
+// scsiHw returns the SCSI controller model, IO threads need one controller per disk
+// and Proxmox VE 8 uses that for new VMs anyway
+func (d *Driver) scsiHw() string {
+	if d.DiskIOThread || d.driver.GetCapabilities().SCSISingle {
+		return pveIOThreadVmScsiHw
+	}
+	return pveDefaultVmScsiHw
+}
+
+// hasSCSIDevice reports whether any of the devices is attached to the SCSI bus
+func hasSCSIDevice(devices map[string]string) bool {
+	for key := range devices {
+		if strings.HasPrefix(key, "scsi") {
+			return true
+		}
+	}
+	return false
+}
+
+// ciUpgrade disables the package upgrade cloud-init does on the first boot since Proxmox VE 8.1,
+// it delays SSH for minutes; older versions reject the option
+func (d *Driver) ciUpgrade() string {
+	if d.driver.GetCapabilities().CIUpgrade {
+		return "0"
+	}
+	return ""
+}
+
+// netConfig returns the net0 definition, a VLAN tag of 0 means untagged
+func (d *Driver) netConfig() string {
+	model := d.NetModel
+	if d.NetMacAddr != "" {
+		// the MAC address is given as value of the model, e.g. virtio=BC:24:11:00:00:01
+		model += "=" + d.NetMacAddr
+	}
+	net := fmt.Sprintf("%s,bridge=%s", model, d.NetBridge)
+	if d.NetVlanTag > 0 {
+		net = fmt.Sprintf("%s,tag=%d", net, d.NetVlanTag)
+	}
+	if d.NetQueues > 0 {
+		net = fmt.Sprintf("%s,queues=%d", net, d.NetQueues)
+	}
+	if d.NetRate != "" {
+		net = fmt.Sprintf("%s,rate=%s", net, d.NetRate)
+	}
+	if d.Firewall {
+		net = fmt.Sprintf("%s,firewall=1", net)
+	}
+	return net
+}
+
+// pc, q35 and their pinned versions like pc-i440fx-7.2 or pc-q35-8.0+pve1
+var pveMachineTypeRegexp = regexp.MustCompile(`^(pc|q35|pc-i440fx-[0-9]+\.[0-9]+|pc-q35-[0-9]+\.[0-9]+)(\+pve[0-9]+)?$`)
+
+// CPU model optionally followed by flags, e.g. host or x86-64-v2-AES,flags=+pcid;-hv-evmcs
+var pveCpuTypeRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+(,flags=[+-][A-Za-z0-9._-]+(;[+-][A-Za-z0-9._-]+)*)?$`)
+
+// disk or network device to boot from, e.g. scsi0, ide2 or net0
+var pveBootDeviceRegexp = regexp.MustCompile(`^((ide|sata|scsi|virtio)[0-9]+|net[0-9])$`)
+
+// unicast MAC address like BC:24:11:00:00:01
+var pveMacAddrRegexp = regexp.MustCompile(`^[0-9A-F][02468ACE](:[0-9A-F]{2}){5}$`)
+
+// PCI devices like 0000:01:00, 01:00.0 or several functions joined by ';', or a resource mapping,
+// followed by options like pcie=1,x-vga=1
+var pveHostPCIRegexp = regexp.MustCompile(`^((host=)?([0-9a-fA-F]{4}:)?[0-9a-fA-F]{2}:[0-9a-fA-F]{2}(\.[0-7])?(;([0-9a-fA-F]{4}:)?[0-9a-fA-F]{2}:[0-9a-fA-F]{2}(\.[0-7])?)*|mapping=[A-Za-z0-9_-]+)(,[a-z_-]+=[^,]+)*$`)
+
+// USB devices by vendor:product like host=1234:5678 or by port like host=1-2.3, or a resource mapping,
+// optionally on a USB3 port
+var pveUSBRegexp = regexp.MustCompile(`^(host=([0-9a-fA-F]{4}:[0-9a-fA-F]{4}|[0-9]+-[0-9]+(\.[0-9]+)*)|mapping=[A-Za-z0-9_-]+)(,usb3=[01])?$`)
+
+// snapshot names as accepted by Proxmox VE, e.g. before-upgrade
+var pveSnapshotNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,39}$`)
+
+// VM names as accepted by Proxmox VE, i.e. DNS names like docker-01 or docker-01.example.com
+var pveDNSNameRegexp = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+
+// VM tags as accepted by Proxmox VE
+var pveTagRegexp = regexp.MustCompile(`^[a-z0-9_.-]+$`)
+
+// number of disks that can be attached to each bus
+var pveDiskBusSlots = map[string]int{
+	"ide":    4,
+	"sata":   6,
+	"scsi":   31,
+	"virtio": 16,
+}
+
+// storageVolume identifies an allocated volume
+type storageVolume struct {
+	storage string
+	volume  string
+}
+
+// extraDisk is an additional data disk given by --proxmoxve-extra-disk
+type extraDisk struct {
+	size    string
+	storage string
+	bus     string
+}
+
+// extraDisks parses the additional data disks, storage and bus default to the ones of the root disk
+func (d *Driver) extraDisks() ([]extraDisk, error) {
+	disks := []extraDisk{}
+	for _, spec := range d.ExtraDisks {
+		disk := extraDisk{storage: d.Storage, bus: d.DiskBus}
+		for _, option := range strings.Split(spec, ",") {
+			kv := strings.SplitN(option, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("extra disk option '%s' is not in the form key=value", option)
+			}
+			switch strings.TrimSpace(kv[0]) {
+			case "size":
+				disk.size = strings.ToUpper(strings.TrimSpace(kv[1]))
+			case "storage":
+				disk.storage = strings.TrimSpace(kv[1])
+			case "bus":
+				disk.bus = strings.ToLower(strings.TrimSpace(kv[1]))
+			default:
+				return nil, fmt.Errorf("extra disk option '%s' is not supported", kv[0])
+			}
+		}
+
+		if govalidator.IsInt(disk.size) {
+			disk.size += "G"
+		}
+		if len(disk.size) < 2 || !govalidator.IsInt(disk.size[:len(disk.size)-1]) || !strings.ContainsAny(disk.size[len(disk.size)-1:], "MG") {
+			return nil, fmt.Errorf("extra disk '%s' needs a size in the form 50G or 512M", spec)
+		}
+		if _, ok := pveDiskBusSlots[disk.bus]; !ok {
+			return nil, fmt.Errorf("disk bus '%s' of extra disk '%s' is not supported", disk.bus, spec)
+		}
+		disks = append(disks, disk)
+	}
+	return disks, nil
+}
+
+// requiredStorage returns the bytes needed on each storage for the root disk and the extra disks,
+// the root disk of a clone is left out since its size depends on the template
+func (d *Driver) requiredStorage() (map[string]int64, error) {
+	required := map[string]int64{}
+	if d.CloneVMID == "" && d.CloneTemplateName == "" {
+		size, err := strconv.ParseInt(d.DiskSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("disk size '%s' is not a number of GB", d.DiskSize)
+		}
+		required[d.RootDiskStorage] += size << 30
+	}
+
+	disks, err := d.extraDisks()
+	if err != nil {
+		return nil, err
+	}
+	for _, disk := range disks {
+		// extraDisks guarantees a number followed by M or G
+		size, _ := strconv.ParseInt(disk.size[:len(disk.size)-1], 10, 64)
+		if strings.HasSuffix(disk.size, "G") {
+			size <<= 30
+		} else {
+			size <<= 20
+		}
+		required[disk.storage] += size
+	}
+	return required, nil
+}
+
+// diskFilename returns the volume name of the VM's disk with the given index,
+// disks on dir storages are files named after their format
+func (d *Driver) diskFilename(storageType string, index int) string {
+	filename := fmt.Sprintf("vm-%s-disk-%d", d.VMID, index)
+	if storageType == "dir" {
+		filename += "." + d.StorageType
+	}
+	return filename
+}
+
+// diskPreallocation returns the preallocation mode for the volume, only disk
+// files can be preallocated
+func (d *Driver) diskPreallocation(filename string) string {
+	if path.Ext(filename) == "" {
+		return ""
+	}
+	return d.DiskPreallocation
+}
+
+// checkThinProvisioning makes sure volumes on storages of the given type are allocated
+// thin, disk files are not preallocated beyond their metadata
+func (d *Driver) checkThinProvisioning(storageType string) error {
+	switch storageType {
+	case "lvm", "iscsi", "iscsidirect":
+		return fmt.Errorf("storage '%s' of type '%s' does not support thin provisioning, use e.g. lvmthin", d.RootDiskStorage, storageType)
+	case "zfspool":
+		d.warnf("Volumes on storage '%s' are only thin if the storage has the sparse option set", d.RootDiskStorage)
+	case "dir":
+		switch d.DiskPreallocation {
+		case "falloc", "full":
+			return fmt.Errorf("--%s conflicts with --%s %s", pveDiskThinParameter, pveDiskPreallocationParameter, d.DiskPreallocation)
+		case "":
+			// the storage default may preallocate the whole file
+			d.DiskPreallocation = "off"
+			if d.StorageType == "qcow2" {
+				d.DiskPreallocation = "metadata"
+			}
+		}
+	}
+	return nil
+}
+
+// checkStorageFormat picks the disk format if none was requested and fails if
+// the requested one is not supported by storages of the given type
+func (d *Driver) checkStorageFormat(storageType string) error {
+	switch storageType {
+	case "lvm", "lvmthin", "zfs", "zfspool", "rbd", "ceph":
+		if d.StorageType == "" {
+			log.Infof("Storage '%s' of type '%s' only supports raw disks, using raw", d.RootDiskStorage, storageType)
+			d.StorageType = "raw"
+		}
+		if d.StorageType != "raw" {
+			return fmt.Errorf("type '%s' on storage '%s' does only support raw, use --%s raw or leave it unset",
+				storageType, d.RootDiskStorage, pveStorageTypeParameter)
+		}
+	}
+	if d.StorageType == "" {
+		d.StorageType = pveDefaultStorageType
+	}
+	return nil
+}
+
+// checkStorages makes sure the storages given for the disks exist on the node
+func (d *Driver) checkStorages() error {
+	// pairs of flag and storage
+	storages := [][2]string{
+		{pveStorageParameter, d.Storage},
+		{pveRootDiskStorageParameter, d.RootDiskStorage},
+	}
+	if d.CloudInit {
+		storages = append(storages, [2]string{pveCloudInitStorageParameter, d.CloudInitStorage})
+	}
+
+	checked := map[string]bool{}
+	for _, s := range storages {
+		flag, storage := s[0], s[1]
+		if storage == "" || checked[storage] {
+			continue
+		}
+		checked[storage] = true
+		d.debugf("Looking up storage '%s'", storage)
+		if _, err := d.driver.GetStorageType(d.Node, storage); err != nil {
+			return fmt.Errorf("--%s: %s", flag, err)
+		}
+	}
+	return nil
+}
+
+// checkStorageSpace makes sure every storage has room for the disks allocated on it
+func (d *Driver) checkStorageSpace() error {
+	required, err := d.requiredStorage()
+	if err != nil {
+		return err
+	}
+
+	storages := make([]string, 0, len(required))
+	for storage := range required {
+		storages = append(storages, storage)
+	}
+	sort.Strings(storages)
+
+	for _, storage := range storages {
+		d.debugf("Checking free space on storage '%s'", storage)
+		status, err := d.driver.GetStorageStatus(d.Node, storage)
+		if err != nil {
+			return err
+		}
+		if status.Avail < required[storage] {
+			return fmt.Errorf("storage '%s' has %.1f GB available, but the disks need %.1f GB",
+				storage, float64(status.Avail)/(1<<30), float64(required[storage])/(1<<30))
+		}
+	}
+	return nil
+}
+
+// passthroughDevices returns the PCI and USB devices to pass through keyed by hostpci0, ..., usb0, ...
+func (d *Driver) passthroughDevices() map[string]string {
+	devices := map[string]string{}
+	for i, dev := range d.HostPCI {
+		devices[fmt.Sprintf("hostpci%d", i)] = dev
+	}
+	for i, dev := range d.USB {
+		devices[fmt.Sprintf("usb%d", i)] = dev
+	}
+	return devices
+}
+
+// nextDiskKey returns the first unused parameter name on the bus, ide2 is reserved for the CD-ROM
+func nextDiskKey(bus string, devices map[string]string) (string, error) {
+	for i := 0; i < pveDiskBusSlots[bus]; i++ {
+		key := fmt.Sprintf("%s%d", bus, i)
+		if _, used := devices[key]; !used && key != "ide2" {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("no free slot left on disk bus '%s'", bus)
+}
+
+// checkIntRange makes sure the value of the flag is an integer within min and max
+func checkIntRange(flag string, value string, min int, max int) error {
+	if value == "" || !govalidator.IsInt(value) {
+		return fmt.Errorf("--%s must be an integer, got '%s'", flag, value)
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < min || i > max {
+		return fmt.Errorf("--%s must be between %d and %d, got '%s'", flag, min, max, value)
+	}
+	return nil
+}
+
+// boolParam converts a bool to the 1/0 form of the API for string parameters
+func boolParam(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// parseBoolFlag parses a boolean given as string flag, bool flags of docker-machine cannot default to true
+func parseBoolFlag(flag string, value string) (bool, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("--%s must be true or false, got '%s'", flag, value)
+	}
+	return b, nil
+}
+
+// memorySizeMB returns the memory in MB, an amount given in MB wins over the one in GB
+func memorySizeMB(gb int, mb int) int {
+	if mb > 0 {
+		return mb
+	}
+	return gb * 1024
+}
+
+// balloonConfig returns the balloon target in MB, empty to keep the Proxmox VE default
+func (d *Driver) balloonConfig() string {
+	if d.MemoryMin <= 0 {
+		return ""
+	}
+	return strconv.Itoa(d.MemoryMin)
+}
+
+// cpuConfig returns the cpu definition including the pcid and spec-ctrl flags,
+// an empty string leaves the CPU type to Proxmox VE
+func (d *Driver) cpuConfig() string {
+	flags := []string{}
+	if d.Pcid {
+		flags = append(flags, "+pcid")
+	}
+	if d.SpecCtrl {
+		flags = append(flags, "+spec-ctrl")
+	}
+	if len(flags) == 0 {
+		return d.CpuType
+	}
+
+	cpuType := d.CpuType
+	if cpuType == "" {
+		// flags can not be given without a type
+		cpuType = pveDefaultVmCpuType
+	}
+	if strings.Contains(cpuType, ",flags=") {
+		return cpuType + ";" + strings.Join(flags, ";")
+	}
+	return cpuType + ",flags=" + strings.Join(flags, ";")
+}
+
+// agentConfig returns the agent definition, the sub-options are only added if they differ
+// from the Proxmox VE defaults, as older versions do not know all of them
+func (d *Driver) agentConfig() string {
+	agent := boolParam(!d.NoAgent)
+	if d.NoAgent {
+		return agent
+	}
+	if d.AgentFstrim {
+		agent += ",fstrim_cloned_disks=1"
+	}
+	if !d.AgentFreezeFs {
+		agent += ",freeze-fs-on-backup=0"
+	}
+	return agent
+}
+
+// rngConfig returns the rng0 device, limited to 1 KiB per second so a guest can not drain the host's entropy,
+// empty if no RNG device is wanted
+func (d *Driver) rngConfig() string {
+	if !d.Rng {
+		return ""
+	}
+	return "source=/dev/urandom,max_bytes=1024,period=1000"
+}
+
+// cpuLimitConfig returns the CPU limit, empty for unlimited to keep the Proxmox VE default
+func (d *Driver) cpuLimitConfig() string {
+	if limit, err := strconv.ParseFloat(d.CpuLimit, 64); err != nil || limit == 0 {
+		return ""
+	}
+	return d.CpuLimit
+}
+
+// cpuUnitsConfig returns the CPU weight, empty to keep the Proxmox VE default
+func (d *Driver) cpuUnitsConfig() string {
+	if d.CpuUnits <= 0 {
+		return ""
+	}
+	return strconv.Itoa(d.CpuUnits)
+}
+
+// checkCpuUnits makes sure the CPU weight is within the range of the Proxmox VE version,
+// 7 and later use cgroup v2 with 1 - 10000 instead of 2 - 262144
+func checkCpuUnits(units int, caps Capabilities) error {
+	min, max := 1, 10000
+	if caps.Major > 0 && !caps.CgroupV2 {
+		min, max = 2, 262144
+	}
+	if units < min || units > max {
+		return fmt.Errorf("--%s must be between %d and %d on Proxmox VE %d.%d, got %d", pveCpuUnitsParameter, min, max, caps.Major, caps.Minor, units)
+	}
+	return nil
+}
+
+// checkCapabilities rejects features the host is too old for, a version that could not be parsed is trusted
+func (d *Driver) checkCapabilities(caps Capabilities) error {
+	if caps.Major == 0 {
+		return nil
+	}
+	if d.CloudInit && !caps.CloudInitDrive {
+		return fmt.Errorf("--%s requires Proxmox VE 5.2 or later, the host runs %d.%d", pveCloudInitParameter, caps.Major, caps.Minor)
+	}
+	if len(d.HostPCI) > 0 && !caps.Q35 {
+		return fmt.Errorf("--%s requires the q35 machine type of Proxmox VE 4 or later, the host runs %d.%d", pveHostPCIParameter, caps.Major, caps.Minor)
+	}
+	if len(d.Tags) > 0 && !caps.Tags {
+		return fmt.Errorf("--%s requires Proxmox VE 7 or later, the host runs %d.%d", pveTagParameter, caps.Major, caps.Minor)
+	}
+	if !d.NoAgent && !d.AgentFreezeFs && !caps.AgentFreezeFs {
+		return fmt.Errorf("--%s false requires Proxmox VE 7.4 or later, the host runs %d.%d", pveAgentFreezeFsParameter, caps.Major, caps.Minor)
+	}
+	return nil
+}
+
+// checkDisplay validates the display type, a VM without display and serial console can not be debugged
+func (d *Driver) checkDisplay() error {
+	if d.Vga == "" {
+		return nil
+	}
+	vgaType := strings.SplitN(d.Vga, ",", 2)[0]
+	switch vgaType {
+	case "std", "cirrus", "vmware", "qxl", "qxl2", "qxl3", "qxl4", "virtio", "virtio-gl":
+		break
+	case "none":
+		if !d.Serial {
+			d.warnf("The VM has no display and no serial console, add --%s to be able to debug boot problems", pveSerialParameter)
+		}
+	case "serial0":
+		if !d.Serial {
+			return fmt.Errorf("display type 'serial0' requires --%s", pveSerialParameter)
+		}
+	default:
+		return fmt.Errorf("display type '%s' is not supported", vgaType)
+	}
+	return nil
+}
+
+// serialConfig returns the serial0 device if the serial console is enabled
+func (d *Driver) serialConfig() string {
+	if d.Serial {
+		return "socket"
+	}
+	return ""
+}
+
+// isoKey returns the device the boot image is attached to
+func (d *Driver) isoKey() string {
+	if !d.CloudInit {
+		return "ide2"
+	}
+	// the cloud-init drive takes ide2, so the boot image moves to the next free ide slot
+	if d.DiskBus == "ide" {
+		return "ide1"
+	}
+	return "ide0"
+}
+
+// bootConfig returns the boot parameter, booting from the root disk first and the
+// boot image second unless a boot order was given
+func (d *Driver) bootConfig() string {
+	order := d.BootOrder
+	if order == "" {
+		order = d.rootDiskKey() + ";" + d.isoKey()
+	}
+	return "order=" + order
+}
+
+// diskConfig returns the definition of the root disk on the given volume including its options
+func (d *Driver) diskConfig(volume string) string {
+	config := volume
+	if d.DiskCache != "" {
+		config += ",cache=" + d.DiskCache
+	}
+	if d.DiskSSD {
+		config += ",ssd=1"
+	}
+	if d.DiskDiscard {
+		config += ",discard=on"
+	}
+	if d.DiskIOThread {
+		config += ",iothread=1"
+	}
+	return config
+}
+
+// rootDiskKey returns the parameter name the root disk is attached as, e.g. scsi0
+func (d *Driver) rootDiskKey() string {
+	return d.DiskBus + "0"
+}
+
+// netConfigs returns the definitions of all network interfaces starting with net0
+func (d *Driver) netConfigs() []string {
+	if len(d.Networks) == 0 {
+		return []string{d.netConfig()}
+	}
+	return d.Networks
+}
+
+// checkNetworks validates the interfaces given with --proxmoxve-net, the flags of the generated
+// net0 would be dropped silently next to them
+func (d *Driver) checkNetworks() error {
+	if len(d.Networks) > pveMaxVmNetworks {
+		return fmt.Errorf("at most %d network interfaces are supported, got %d", pveMaxVmNetworks, len(d.Networks))
+	}
+	if len(d.Networks) == 0 {
+		return nil
+	}
+	for _, flag := range []struct {
+		name   string
+		set    bool
+		option string
+	}{
+		{pveNetVlanTagParameter, d.NetVlanTag > 0, "tag="},
+		{pveNetQueuesParameter, d.NetQueues > 0, "queues="},
+		{pveNetMacAddrParameter, d.NetMacAddr != "", "macaddr="},
+		{pveNetRateParameter, d.NetRate != "", "rate="},
+		{pveFirewallParameter, d.Firewall, "firewall=1"},
+	} {
+		if flag.set {
+			return fmt.Errorf("--%s can not be combined with --%s, add %s to the interfaces instead", flag.name, pveNetParameter, flag.option)
+		}
+	}
+	return nil
+}
+
+// ipConfig returns the cloud-init ipconfig0 value for the static address
+func (d *Driver) ipConfig() (string, error) {
+	cidr := d.StaticIPAddress
+	if !strings.Contains(cidr, "/") {
+		if d.StaticNetmask == "" {
+			return "", fmt.Errorf(pveDiverMissingOptionMessageFmt, pveNetmaskParameter)
+		}
+		prefix := d.StaticNetmask
+		if govalidator.IsIPv4(prefix) {
+			ones, bits := net.IPMask(net.ParseIP(prefix).To4()).Size()
+			if bits == 0 {
+				return "", fmt.Errorf("netmask '%s' is not valid", d.StaticNetmask)
+			}
+			prefix = strconv.Itoa(ones)
+		}
+		cidr = d.StaticIPAddress + "/" + prefix
+	}
+
+	if !govalidator.IsCIDR(cidr) {
+		return "", fmt.Errorf("static address '%s' is not a valid CIDR", cidr)
+	}
+
+	// IPv6 addresses and gateways have their own keys
+	ipKey, gwKey := "ip", "gw"
+	ipv6 := govalidator.IsIPv6(strings.SplitN(cidr, "/", 2)[0])
+	if ipv6 {
+		ipKey, gwKey = "ip6", "gw6"
+	}
+
+	config := ipKey + "=" + cidr
+	if d.StaticGateway != "" {
+		if !govalidator.IsIP(d.StaticGateway) {
+			return "", fmt.Errorf("gateway '%s' is not a valid IP address", d.StaticGateway)
+		}
+		if govalidator.IsIPv6(d.StaticGateway) != ipv6 {
+			return "", fmt.Errorf("gateway '%s' is not of the same address family as '%s'", d.StaticGateway, cidr)
+		}
+		config += "," + gwKey + "=" + d.StaticGateway
+	}
+
+	return config, nil
+}
+
+// cloudInitSSHKeys returns the generated machine key and the additional authorized keys
+// encoded the way the sshkeys parameter of the API expects them
+func (d *Driver) cloudInitSSHKeys() (string, error) {
+	pub, err := ioutil.ReadFile(d.GetSSHKeyPath() + ".pub")
+	if err != nil {
+		return "", err
+	}
+
+	keys := strings.TrimSpace(string(pub))
+	if d.GuestSSHAuthorizedKeys != "" {
+		keys += "\n" + strings.TrimSpace(d.GuestSSHAuthorizedKeys)
+	}
+
+	return strings.Replace(url.QueryEscape(keys), "+", "%20", -1), nil
+}
+
+func (d *Driver) waitForIP() (string, error) {
+	var lastErr error
+	deadline := time.Now().Add(time.Duration(d.ProvisionTimeout) * time.Second)
+	for time.Now().Before(deadline) {
+		ip, err := d.GetIP()
+		if err == nil && ip != "" {
+			return ip, nil
+		}
+		lastErr = err
+		d.debugf("waiting for VM '%s' to report an IP address", d.VMID)
+		time.Sleep(2 * time.Second)
+	}
+
+	if lastErr != nil {
+		return "", fmt.Errorf("VM '%s' did not report a routable IP address within %ds: %s", d.VMID, d.ProvisionTimeout, lastErr)
+	}
+	return "", fmt.Errorf("VM '%s' did not report a routable IP address within %ds, check the network configuration of the guest", d.VMID, d.ProvisionTimeout)
+}
+
+func (d *Driver) waitAndPrepareSSH() error {
+
+	sshUser := d.GetSSHUsername()
+	started := time.Now()
+	if d.ProvisionStartDelay > 0 {
+		d.debugf("waiting for VM to become active, first wait %d seconds", d.ProvisionStartDelay)
+		time.Sleep(time.Duration(d.ProvisionStartDelay) * time.Second)
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User: sshUser,
+		Auth: []ssh.AuthMethod{
+			ssh.Password(pveDefaultVmGuestUserPassword),
+		},
+		HostKeyCallback: d.hostKeyCallback(),
+		Timeout:         d.sshDialTimeout(),
+	}
+
+	pub, err := ioutil.ReadFile(d.GetSSHKeyPath() + ".pub")
+	if err != nil {
+		return err
+	}
+
+	// sshd may still be starting right after boot and drop the first connections,
+	// so the key installation is retried unless the command itself failed
+	var conn *ssh.Client
+	var clientstr string
+	delay := time.Second
+	for attempt := 1; ; attempt++ {
+		// the guest password is fixed, an authentication failure will not go away
+		conn, clientstr, err = d.waitForSSH(sshConfig, false)
+		if err != nil {
+			return err
+		}
+		if attempt == 1 {
+			d.debugf("VM '%s' reachable at %s after %s", d.VMID, clientstr, time.Since(started).Round(time.Millisecond))
+		}
+
+		var output string
+		output, err = d.installKey(conn, clientstr, sshUser, pub)
+		if err == nil {
+			break
+		}
+		conn.Close()
+		if _, failed := err.(*ssh.ExitError); failed || attempt == pveSSHKeyInstallAttempts {
+			return fmt.Errorf("Could not install the public key on %s: %s %s", clientstr, err, output)
+		}
+		d.debugf("Attempt %d of %d to install the public key on %s failed, retrying in %s: %s", attempt, pveSSHKeyInstallAttempts, clientstr, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	defer conn.Close()
+
+	if d.ProvisionScript != "" {
+		return d.runProvisionScript(conn, clientstr)
+	}
+	return nil
+}
+
+// installKey adds the public key to the authorized keys of the user and returns the output of the command
+func (d *Driver) installKey(conn *ssh.Client, clientstr string, sshUser string, pub []byte) (string, error) {
+	sshbasedir := sshDir(sshUser, d.homeDir(conn))
+	d.debugf("Installing public key to %s:%s", clientstr, sshbasedir)
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var output bytes.Buffer
+	session.Stdin = bytes.NewReader(pub)
+	session.Stdout = &output
+	session.Stderr = &output
+	err = session.Run(authorizedKeysInstallCommand(sshbasedir, d.ReplaceAuthorizedKeys))
+	d.debugf("%s -> %s", clientstr, output.String())
+	return strings.TrimSpace(output.String()), err
+}
+
+// dialWithKey logs into the guest with the installed key, retryAuth is passed on to waitForSSH
+func (d *Driver) dialWithKey(retryAuth bool) (*ssh.Client, string, error) {
+	_, priv, err := ReadKeyPair(d.GetSSHKeyPath())
+	if err != nil {
+		return nil, "", err
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(priv))
+	if err != nil {
+		return nil, "", err
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:            d.GetSSHUsername(),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: d.hostKeyCallback(),
+		Timeout:         d.sshDialTimeout(),
+	}
+	return d.waitForSSH(sshConfig, retryAuth)
+}
+
+// runProvisionScriptWithKey logs into the guest with the installed key and runs the
+// provision script, cloud-init VMs have no password login to reuse
+func (d *Driver) runProvisionScriptWithKey() error {
+	// cloud-init may install the key only after sshd is up, so authentication failures are retried
+	conn, clientstr, err := d.dialWithKey(true)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return d.runProvisionScript(conn, clientstr)
+}
+
+// runProvisionScript copies the provision script to a temporary file on the guest and runs
+// it there, so its shebang is honored. The output is logged line by line in debug mode.
+func (d *Driver) runProvisionScript(conn *ssh.Client, clientstr string) error {
+	script, err := os.Open(d.ProvisionScript)
+	if err != nil {
+		return err
+	}
+	defer script.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	d.debugf("Running provision script '%s' on %s", d.ProvisionScript, clientstr)
+	output := &lineWriter{fn: func(line string) {
+		d.debugf("%s: %s", clientstr, line)
+	}}
+	session.Stdin = script
+	session.Stdout = output
+	session.Stderr = output
+	err = session.Run(provisionScriptCommand)
+	output.Flush()
+	if err != nil {
+		return fmt.Errorf("provision script '%s' failed on %s: %s %s", d.ProvisionScript, clientstr, err, output.Last())
+	}
+	return nil
+}
+
+// provisionScriptCommand stores the script read from stdin in a temporary file, runs it
+// and removes it again, exiting with the status of the script
+const provisionScriptCommand = `f=$(mktemp) && cat > "$f" && chmod 700 "$f" && { "$f"; rc=$?; rm -f "$f"; exit $rc; }`
+
+// lineWriter calls fn for every complete line written to it, it can be shared by
+// the stdout and stderr of a session which are copied concurrently
+type lineWriter struct {
+	mu      sync.Mutex
+	pending []byte
+	last    string
+	fn      func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(w.pending[:i]))
+		w.pending = w.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes an incomplete last line on
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) > 0 {
+		w.line(string(w.pending))
+		w.pending = nil
+	}
+}
+
+// Last returns the last non-empty line written
+func (w *lineWriter) Last() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+func (w *lineWriter) line(line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) != "" {
+		w.last = line
+	}
+	w.fn(line)
+}
+
+// sshDialTimeout returns how long a single SSH connection attempt may take,
+// machines created before the timeout was configurable fall back to the default
+func (d *Driver) sshDialTimeout() time.Duration {
+	if d.SSHDialTimeout <= 0 {
+		return pveDefaultSSHDialTimeout * time.Second
+	}
+	return time.Duration(d.SSHDialTimeout) * time.Second
 }
 
-//func (d *Driver) GetSSHKeyPath() string {
-//	return d.GetSSHKeyPath() + ".pub"
-//}
+// hostKeyCallback returns the verification of the guest's SSH host key. In pin mode
+// the first key seen is added to known_hosts in the machine directory and every later
+// connection must present the same key.
+func (d *Driver) hostKeyCallback() ssh.HostKeyCallback {
+	if d.SSHHostKeyCheck != pveSSHHostKeyPin {
+		return ssh.InsecureIgnoreHostKey()
+	}
+
+	file := d.ResolveStorePath("known_hosts")
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if _, err := os.Stat(file); err == nil {
+			check, err := knownhosts.New(file)
+			if err != nil {
+				return err
+			}
+			err = check(hostname, remote, key)
+			if err == nil {
+				return nil
+			}
+			e, ok := err.(*knownhosts.KeyError)
+			if !ok {
+				return err
+			}
+			if len(e.Want) > 0 {
+				return fmt.Errorf("SSH host key of %s changed to %s, remove %s if the VM was reinstalled", hostname, ssh.FingerprintSHA256(key), file)
+			}
+			// the host is not known yet
+		}
 
-func (d *Driver) GetSSHPort() (int, error) {
-	if d.SSHPort == 0 {
-		d.SSHPort = 22
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		if err != nil {
+			return err
+		}
+		log.Infof("Pinned SSH host key of %s with fingerprint %s", hostname, ssh.FingerprintSHA256(key))
+		return nil
 	}
+}
 
-	return d.SSHPort, nil
+// sshAuthFailed reports whether the SSH server rejected all authentication methods, the
+// connection itself worked so retrying with the same credentials does not help
+func sshAuthFailed(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "unable to authenticate")
 }
 
-func (d *Driver) GetSSHUsername() string {
-	if d.SSHUser == "" {
-		d.SSHUser = pveDefaultVmGuestUserName
+// waitForSSH connects to the guest as soon as it accepts SSH logins, retrying with
+// exponential backoff until the provision timeout is reached, rejected credentials
+// are only retried with retryAuth
+func (d *Driver) waitForSSH(config *ssh.ClientConfig, retryAuth bool) (*ssh.Client, string, error) {
+	deadline := time.Now().Add(time.Duration(d.ProvisionTimeout) * time.Second)
+	delay := time.Second
+	for {
+		clientstr, err := d.sshAddress()
+		if err == nil {
+			var conn *ssh.Client
+			conn, err = ssh.Dial("tcp", clientstr, config)
+			if err == nil {
+				return conn, clientstr, nil
+			}
+			if !retryAuth && sshAuthFailed(err) {
+				return nil, "", fmt.Errorf("could not log into %s as '%s': %s", clientstr, config.User, err)
+			}
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			return nil, "", fmt.Errorf("VM did not become reachable within %ds: %s", d.ProvisionTimeout, err)
+		}
+		d.debugf("waiting for VM to accept SSH connections, retrying in %s: %s", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > pveSSHMaxPollInterval {
+			delay = pveSSHMaxPollInterval
+		}
 	}
+}
 
-	return d.SSHUser
+// sshAddress returns host:port of the guest's SSH server
+func (d *Driver) sshAddress() (string, error) {
+	hostname, err := d.GetSSHHostname()
+	if err != nil {
+		return "", err
+	}
+	if hostname == "" {
+		return "", fmt.Errorf("VM '%s' did not report an IP address yet", d.VMID)
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%d", hostname, port), nil
 }
 
-func (d *Driver) GetState() (state.State, error) {
-	err := d.connectAPI()
+// homeDirCommand prints the home directory of the logged in user
+const homeDirCommand = `printf '%s' "$HOME"`
+
+// homeDir returns the home directory the guest reports for the SSH user, empty if it could not be read
+func (d *Driver) homeDir(conn *ssh.Client) string {
+	session, err := conn.NewSession()
 	if err != nil {
-		return state.Paused, err
+		d.debugf("Could not open a session to read the home directory: %s", err)
+		return ""
 	}
+	defer session.Close()
 
-	if d.ping() {
-		return state.Running, nil
+	output, err := session.Output(homeDirCommand)
+	if err != nil {
+		d.debugf("Could not read the home directory: %s", err)
+		return ""
 	}
-	return state.Paused, nil
+	return string(output)
 }
 
-func (d *Driver) PreCreateCheck() error {
+// sshDir returns the .ssh directory in the given home directory, if the home directory
+// is not known it falls back to /root for root and /home/<user> for everybody else
+func sshDir(user string, home string) string {
+	home = strings.TrimSpace(home)
+	if !path.IsAbs(home) {
+		if user == "root" {
+			home = "/root"
+		} else {
+			home = "/home/" + user
+		}
+	}
+	return path.Join(home, ".ssh")
+}
 
-	switch d.StorageType {
-	case "raw":
-		fallthrough
-	case "qcow2":
-		break
-	default:
-		return fmt.Errorf("storage type '%s' is not supported", d.StorageType)
+// authorizedKeysInstallCommand returns the shell command that creates the .ssh directory
+// and adds the public key read from stdin to authorized_keys. The key is appended unless
+// it is already present, or replaces the file if replace is set.
+func authorizedKeysInstallCommand(sshdir string, replace bool) string {
+	dir := shellQuote(sshdir)
+	if replace {
+		return fmt.Sprintf("mkdir -p -m 700 %s && install -m 600 /dev/stdin %s/authorized_keys", dir, dir)
 	}
 
+	file := dir + "/authorized_keys"
+	return fmt.Sprintf("mkdir -p -m 700 %s && touch %s && chmod 600 %s && key=$(cat) && "+
+		"{ grep -qxF \"$key\" %s || { [ -s %s ] && [ -n \"$(tail -c 1 %s)\" ] && echo >> %s; printf '%%s\\n' \"$key\" >> %s; }; }",
+		dir, file, file, file, file, file, file, file)
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// Start starts the VM and waits until Proxmox VE reports it as running
+func (d *Driver) Start() error {
 	err := d.connectAPI()
 	if err != nil {
 		return err
 	}
 
-	d.debug("Retrieving next ID")
-	id, err := d.driver.ClusterNextIDGet(0)
+	d.debugf("Starting VM '%s'", d.VMID)
+	taskid, err := d.driver.NodesNodeQemuVMIDStatusStartPost(d.Node, d.VMID)
 	if err != nil {
 		return err
 	}
-	d.debugf("Next ID was '%s'", id)
-	d.VMID = id
-
-	storageType, err := d.driver.GetStorageType(d.Node, d.Storage)
+	err = d.waitForTask(taskid)
 	if err != nil {
-		return err
+		return fmt.Errorf("could not start VM '%s': %s", d.VMID, err)
 	}
 
-	filename := "vm-" + d.VMID + "-disk-0"
-	switch storageType {
-	case "lvmthin":
-		fallthrough
-	case "zfs":
-		fallthrough
-	case "ceph":
-		if d.StorageType != "raw" {
-			return fmt.Errorf("type '%s' on storage '%s' does only support raw", storageType, d.Storage)
+	timeout := d.startTimeout()
+	deadline := time.Now().Add(timeout)
+	for {
+		// a loaded node may fail to report the status for a while
+		st, err := d.driver.NodesNodeQemuVMIDStatusCurrentGet(d.Node, d.VMID)
+		if err == nil && st == state.Running {
+			break
 		}
-	case "dir":
-		filename += "." + d.StorageType
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("VM '%s' is not running %s after it was started, last status error: %s", d.VMID, timeout, err)
+			}
+			return fmt.Errorf("VM '%s' is not running %s after it was started, state is %s", d.VMID, timeout, st)
+		}
+		d.debugf("waiting for VM '%s' to run", d.VMID)
+		time.Sleep(time.Second)
 	}
-	d.StorageFilename = filename
 
-	// create and save a new SSH key pair
-	keyfile := d.GetSSHKeyPath()
-	keypath := path.Dir(keyfile)
-	d.debugf("Generating new key pair at path '%s'", keypath)
-	err = os.MkdirAll(keypath, 0755)
+	if !d.ProvisionPending {
+		return nil
+	}
+	d.debugf("Provisioning VM '%s', it was created with --%s", d.VMID, pveNoStartParameter)
+	err = d.provisionGuest()
 	if err != nil {
 		return err
 	}
-	_, _, err = GetKeyPair(keyfile)
-
-	return err
+	d.ProvisionPending = false
+	return nil
 }
 
-func (d *Driver) Create() error {
+// startTimeout returns how long Start waits for the VM to run, the provision timeout
+// if it is set as HA starts on a loaded node can take a while
+func (d *Driver) startTimeout() time.Duration {
+	if d.ProvisionTimeout <= 0 {
+		return pveDefaultVmStartTimeout * time.Second
+	}
+	return time.Duration(d.ProvisionTimeout) * time.Second
+}
 
-	cloudinit := fmt.Sprintf("%s:cloudinit", d.Storage)
+func (d *Driver) Stop() error {
+	return d.stop(pveDefaultVmShutdownTimeout)
+}
 
-	volume := NodesNodeStorageStorageContentPostParameter{
-		Filename: d.StorageFilename,
-		Size:     d.DiskSize + "G",
-		VMID:     d.VMID,
+// stop shuts the VM down gracefully and waits up to timeout seconds for it to stop
+func (d *Driver) stop(timeout int) error {
+	err := d.connectAPI()
+	if err != nil {
+		return err
 	}
 
-	d.debugf("Creating disk volume '%s' with size '%s'", volume.Filename, volume.Size)
-	err := d.driver.NodesNodeStorageStorageContentPost(d.Node, d.Storage, &volume)
+	st, err := d.GetState()
 	if err != nil {
 		return err
 	}
+	if st == state.Stopped {
+		d.debugf("VM '%s' is already stopped", d.VMID)
+		return nil
+	}
 
-	storageDrive := fmt.Sprintf("%s:%s,size=%s", d.Storage, volume.Filename, volume.Size)
+	d.debugf("Shutting down VM '%s'", d.VMID)
+	taskid, err := d.driver.NodesNodeQemuVMIDStatusShutdownPost(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+	if taskid != "" {
+		d.debugf("Waiting for task '%s'", taskid)
+		err = d.driver.WaitForTask(d.Node, taskid, time.Duration(timeout)*time.Second)
+		if err != nil {
+			return fmt.Errorf("could not shut down VM '%s': %s", d.VMID, err)
+		}
+	}
 
-	net := fmt.Sprintf("%s,bridge=%s", d.NetModel, d.NetBridge)
-	if d.NetVlanTag > 0 {
-		net = fmt.Sprintf("%s,tag=%d", net, d.NetVlanTag)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	for time.Now().Before(deadline) {
+		st, err = d.GetState()
+		if err != nil {
+			return err
+		}
+		if st == state.Stopped {
+			return nil
+		}
+		d.debugf("waiting for VM '%s' to stop", d.VMID)
+		time.Sleep(2 * time.Second)
 	}
 
-	cpuFlags  := ""
-	pcid      := ""
-	specCtrl  := ""
-	separator := ""
-	flags     := false
+	return fmt.Errorf("VM '%s' is still running after %d seconds", d.VMID, timeout)
+}
 
-	if d.SpecCtrl && d.Pcid {
-		separator = ";"
-		flags = true
+func (d *Driver) Restart() error {
+	err := d.connectAPI()
+	if err != nil {
+		return err
 	}
-	if d.Pcid {
-		pcid = "+pcid"
-		flags = true
+
+	st, err := d.GetState()
+	if err != nil {
+		return err
 	}
-	if d.SpecCtrl {
-		specCtrl = "+spec-ctrl"
-		flags = true
+	if st == state.Stopped {
+		d.debugf("VM '%s' is stopped, starting instead of rebooting", d.VMID)
+		return d.Start()
 	}
 
-	if flags {
-		cpuFlags = fmt.Sprintf(",flags=%s%s%s",pcid, separator, specCtrl)
+	d.debugf("Rebooting VM '%s'", d.VMID)
+	taskid, err := d.driver.NodesNodeQemuVMIDStatusRebootPost(d.Node, d.VMID)
+	if err != nil {
+		return err
 	}
-	cpuDefinition := fmt.Sprintf("%s%s", d.CpuType, cpuFlags)
 
-	numa := 0
-	if d.Numa {
-		numa = 1
+	// the task finishes once the guest went down and was started again
+	deadline := time.Now().Add(pveDefaultVmRebootTimeout * time.Second)
+	if taskid != "" {
+		d.debugf("Waiting for task '%s'", taskid)
+		err = d.driver.WaitForTask(d.Node, taskid, pveDefaultVmRebootTimeout*time.Second)
+		if err != nil {
+			return fmt.Errorf("could not reboot VM '%s': %s", d.VMID, err)
+		}
 	}
 
-	npp := NodesNodeQemuPostParameter{
-		VMID:      d.VMID,
-		Memory:    d.Memory,
-		Autostart: pveDefaultVmAutoStart,
-		Agent:     pveDefaultVmAgent,
-		Net0:      net, // Added to support bridge differnet from vmbr0 (vlan tag should be supported as well)
-		Name:      d.BaseDriver.MachineName,
-		SCSI0:     storageDrive,
-		Onboot:    pveDefaultVmOnBoot,
-		Ostype:    pveDefaultVmOsType,
-		KVM:       pveDefaultVmKvm, // if you test in a nested environment, you may have to change this to 0 if you do not have nested virtualization
-		Pool:      d.Pool,
-		Sockets:   d.Sockets,
-		Cores:     d.Cores,
-		Cdrom:     d.ImageFile,
-		SshKeys:   strings.Replace(url.QueryEscape(d.GuestSSHAuthorizedKeys), "+", "%20", -1), // d.GuestSSHAuthorizedKeys, //
-		CPU:       cpuDefinition,
-		Numa:      numa,
-		Citype:    "nocloud",
-		Ciuser:    d.GuestUsername,
-		IDE0:      cloudinit,
-	}
-
-	if d.StorageType == "qcow2" {
-		npp.SCSI0 = d.Storage + ":" + d.VMID + "/" + volume.Filename
+	for time.Now().Before(deadline) {
+		if d.reachable() {
+			return nil
+		}
+		d.debugf("waiting for VM '%s' to come back", d.VMID)
+		time.Sleep(2 * time.Second)
 	}
-	d.debugf("Creating VM '%s' with '%d' of memory", npp.VMID, npp.Memory)
-	err = d.driver.NodesNodeQemuPost(d.Node, &npp)
+
+	return fmt.Errorf("VM '%s' did not come back within %d seconds after reboot", d.VMID, pveDefaultVmRebootTimeout)
+}
+
+// Suspend pauses the VM, its state is kept in the RAM of the node
+func (d *Driver) Suspend() error {
+	return d.suspend(false)
+}
+
+// Hibernate suspends the VM to disk and frees its RAM on the node
+func (d *Driver) Hibernate() error {
+	return d.suspend(true)
+}
+
+func (d *Driver) suspend(todisk bool) error {
+	err := d.connectAPI()
 	if err != nil {
-		// make sure rto remove the created volume
-		d.debugf("Removing disk volume '%s' with size '%s'", volume.Filename, volume.Size)
-		d.driver.NodesNodeStorageStorageContentDelete(d.Node, d.Storage, volume.Filename)
 		return err
 	}
 
-	d.Start()
+	d.debugf("Suspending VM '%s' (to disk: %t)", d.VMID, todisk)
+	suspend := NodesNodeQemuVMIDStatusSuspendPostParameter{Todisk: todisk}
+	taskid, err := d.driver.NodesNodeQemuVMIDStatusSuspendPost(d.Node, d.VMID, &suspend)
+	if err != nil {
+		return err
+	}
+	return d.waitForTask(taskid)
+}
 
-	err = d.waitAndPrepareSSH()
+// Resume continues a VM paused by Suspend or Hibernate
+func (d *Driver) Resume() error {
+	err := d.connectAPI()
 	if err != nil {
 		return err
 	}
 
-	ip, err := d.GetIP()
+	d.debugf("Resuming VM '%s'", d.VMID)
+	taskid, err := d.driver.NodesNodeQemuVMIDStatusResumePost(d.Node, d.VMID)
 	if err != nil {
 		return err
 	}
-	d.IPAddress = ip
-	return nil
+	return d.waitForTask(taskid)
 }
 
-func (d *Driver) waitAndPrepareSSH() error {
-
-	sshUser := d.GetSSHUsername()
-	d.debugf("waiting for VM to become active, first wait 10 seconds")
-	time.Sleep(10 * time.Second)
+// Kill stops the VM immediately, like pulling the power plug
+func (d *Driver) Kill() error {
+	err := d.connectAPI()
+	if err != nil {
+		return err
+	}
 
-	for !d.ping() {
-		d.debugf("waiting for VM to become active")
-		time.Sleep(2 * time.Second)
+	d.debugf("Stopping VM '%s' hard", d.VMID)
+	taskid, err := d.driver.NodesNodeQemuVMIDStatusStopPost(d.Node, d.VMID)
+	if err != nil {
+		return err
 	}
-	d.debugf("VM is active waiting more")
-	time.Sleep(2 * time.Second)
+	return d.waitForTask(taskid)
+}
 
+// Remove stops and destroys the VM including all of its disks, a VM that is already gone is not an error
+func (d *Driver) Remove() error {
+	if d.DryRun {
+		// a dry run created nothing, whatever holds its VMID by now belongs to someone else
+		d.debugf("Machine was a dry run, no VM to remove")
+	} else if err := d.removeVM(); err != nil {
+		return err
+	}
 
+	if d.SSHKeyStorePath != "" {
+		// docker-machine only cleans up its own store
+		for _, file := range []string{d.GetSSHKeyPath(), d.GetSSHKeyPath() + ".pub"} {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				d.warnf("Could not remove SSH key file '%s': %s", file, err)
+			}
+		}
+	}
+	return nil
+}
 
-	sshConfig := &ssh.ClientConfig{
-		User: sshUser,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(pveDefaultVmGuestUserPassword),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+func (d *Driver) removeVM() error {
+	if d.VMID == "" {
+		// the creation failed before a VMID was assigned
+		return nil
 	}
 
-	sshbasedir := "/home/" + sshUser + "/.ssh"
-	hostname, _ := d.GetSSHHostname()
-	port, _ := d.GetSSHPort()
-	clientstr := fmt.Sprintf("%s:%d", hostname, port)
+	err := d.connectAPI()
+	if err != nil {
+		return err
+	}
 
-	d.debugf("Creating directory '%s' on client: %s", sshbasedir, clientstr)
-	conn, err := ssh.Dial("tcp", clientstr, sshConfig)
+	st, err := d.driver.NodesNodeQemuVMIDStatusCurrentGet(d.Node, d.VMID)
+	if notFound(err) {
+		d.debugf("VM '%s' does not exist anymore", d.VMID)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	session, err := conn.NewSession()
+
+	if d.HAGroup != "" {
+		// otherwise the HA manager would start the VM again after it was stopped
+		d.debugf("Removing VM '%s' from the HA manager", d.VMID)
+		err = d.driver.ClusterHAResourcesSIDDelete(d.haResourceID())
+		if err != nil {
+			// the resource is already gone if a previous removal failed later on
+			d.warnf("Could not remove VM '%s' from the HA manager: %s", d.VMID, err)
+		}
+	}
+
+	if st != state.Stopped {
+		err = d.stop(pveDefaultVmRemoveTimeout)
+		if err != nil {
+			d.debugf("Graceful shutdown of VM '%s' failed: %s", d.VMID, err)
+			err = d.Kill()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	d.debugf("Destroying VM '%s'", d.VMID)
+	destroy := NodesNodeQemuVMIDDeleteParameter{Purge: true, DestroyUnreferencedDisks: true}
+	taskid, err := d.driver.NodesNodeQemuVMIDDelete(d.Node, d.VMID, &destroy)
+	if notFound(err) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	return d.waitForTask(taskid)
+}
+
+// Snapshot takes a snapshot of the disks of the VM and waits for it to finish
+func (d *Driver) Snapshot(name string) error {
+	return d.snapshot(name, false)
+}
 
-	var stdoutBuf bytes.Buffer
-	session.Stdout = &stdoutBuf
-	session.Run("mkdir -p " + sshbasedir)
-	d.debugf(fmt.Sprintf("%s -> %s", hostname, stdoutBuf.String()))
-	session.Close()
+// SnapshotWithState takes a snapshot including the RAM of the running VM, so it resumes where it left off
+func (d *Driver) SnapshotWithState(name string) error {
+	return d.snapshot(name, true)
+}
+
+func (d *Driver) snapshot(name string, vmstate bool) error {
+	if !pveSnapshotNameRegexp.MatchString(name) {
+		return fmt.Errorf("snapshot name '%s' must start with a letter and may only contain letters, digits, '-' and '_'", name)
+	}
 
-	d.debugf("Trying to copy to %s:%s", clientstr, sshbasedir)
-	c, err := sshrw.NewSSHclt(clientstr, sshConfig)
+	err := d.connectAPI()
 	if err != nil {
 		return err
 	}
 
-	// Open a file
-	f, err := os.Open(d.GetSSHKeyPath() + ".pub")
+	snapshot := NodesNodeQemuVMIDSnapshotPostParameter{
+		Snapname:    name,
+		Description: "Created by docker-machine",
+		Vmstate:     vmstate,
+	}
+	d.debugf("Creating snapshot '%s' of VM '%s'", name, d.VMID)
+	taskid, err := d.driver.NodesNodeQemuVMIDSnapshotPost(d.Node, d.VMID, &snapshot)
 	if err != nil {
 		return err
 	}
+	return d.waitForTask(taskid)
+}
 
-	// TODO: always fails with return status 127, but file was copied correclty
-	c.WriteFile(f, sshbasedir+"/authorized_keys")
-	// if err = c.WriteFile(f, sshbasedir+"/authorized_keys"); err != nil {
-	// 	d.debugf("Error on file write: ", err)
-	// }
+// MigrateTo moves the VM to another node of the cluster, a running VM is migrated online.
+// The node is updated on success, the machine configuration must be saved afterwards.
+func (d *Driver) MigrateTo(targetNode string) error {
+	if targetNode == d.Node {
+		return fmt.Errorf("VM '%s' is already on node '%s'", d.VMID, targetNode)
+	}
 
-	// Close the file after it has been copied
-	defer f.Close()
+	err := d.connectAPI()
+	if err != nil {
+		return err
+	}
 
-	return err
-}
+	check, err := d.driver.NodesNodeQemuVMIDMigrateGet(d.Node, d.VMID)
+	if err != nil {
+		return err
+	}
+	if len(check.LocalDisks) > 0 {
+		return fmt.Errorf("VM '%s' can not be migrated, volume '%s' is not on shared storage", d.VMID, check.LocalDisks[0].Volid)
+	}
 
-func (d *Driver) Start() error {
-	err := d.connectAPI()
+	st, err := d.driver.NodesNodeQemuVMIDStatusCurrentGet(d.Node, d.VMID)
 	if err != nil {
 		return err
 	}
-	return d.driver.NodesNodeQemuVMIDStatusStartPost(d.Node, d.VMID)
-}
 
-func (d *Driver) Stop() error {
-	//d.MockState = state.Stopped
-	return nil
-}
+	migrate := NodesNodeQemuVMIDMigratePostParameter{
+		Target: targetNode,
+		Online: st == state.Running,
+	}
+	d.debugf("Migrating VM '%s' from node '%s' to '%s' (online: %t)", d.VMID, d.Node, targetNode, migrate.Online)
+	taskid, err := d.driver.NodesNodeQemuVMIDMigratePost(d.Node, d.VMID, &migrate)
+	if err != nil {
+		return err
+	}
+	err = d.driver.WaitForTask(d.Node, taskid, pveVmMigrateTimeout)
+	if err != nil {
+		return err
+	}
 
-func (d *Driver) Restart() error {
-	d.Stop()
-	d.Start()
-	//d.MockState = state.Running
+	d.Node = targetNode
 	return nil
 }
 
-func (d *Driver) Kill() error {
-	//d.MockState = state.Stopped
-	return nil
-}
+// Upgrade runs the upgrade command on the guest over SSH with the machine's key,
+// the default command upgrades the packages of a Debian based guest
+func (d *Driver) Upgrade() error {
+	conn, clientstr, err := d.dialWithKey(false)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
-func (d *Driver) Remove() error {
-	err := d.connectAPI()
+	session, err := conn.NewSession()
 	if err != nil {
 		return err
 	}
-	return d.driver.NodesNodeQemuVMIDDelete(d.Node, d.VMID)
+	defer session.Close()
+
+	command := d.upgradeCommand()
+	d.debugf("Running upgrade command '%s' on %s", command, clientstr)
+	output := &lineWriter{fn: func(line string) {
+		d.debugf("%s: %s", clientstr, line)
+	}}
+	session.Stdout = output
+	session.Stderr = output
+	err = session.Run(command)
+	output.Flush()
+	if err != nil {
+		return fmt.Errorf("upgrade of VM '%s' failed on %s: %s %s", d.VMID, clientstr, err, output.Last())
+	}
+	return nil
 }
 
-func (d *Driver) Upgrade() error {
-	return nil
+// upgradeCommand returns the command Upgrade runs, machines created before the option get the default
+func (d *Driver) upgradeCommand() string {
+	if d.UpgradeCommand == "" {
+		return pveDefaultUpgradeCommand
+	}
+	return d.UpgradeCommand
 }
 
 func NewDriver(hostName, storePath string) drivers.Driver {
@@ -769,18 +3950,18 @@ func NewDriver(hostName, storePath string) drivers.Driver {
 	}
 }
 
-func GetKeyPair(file string) (string, string, error) {
+func GetKeyPair(file string, keyType string, bits int) (string, string, error) {
 	// read keys from file
 	_, err := os.Stat(file)
 	if err == nil {
 		priv, err := ioutil.ReadFile(file)
 		if err != nil {
-			fmt.Printf("Failed to read file - %s", err)
+			log.Warnf("Failed to read file, generating a new key pair - %s", err)
 			goto genKeys
 		}
 		pub, err := ioutil.ReadFile(file + ".pub")
 		if err != nil {
-			fmt.Printf("Failed to read pub file - %s", err)
+			log.Warnf("Failed to read pub file, generating a new key pair - %s", err)
 			goto genKeys
 		}
 		return string(pub), string(priv), nil
@@ -788,21 +3969,67 @@ func GetKeyPair(file string) (string, string, error) {
 
 	// generate keys and save to file
 genKeys:
-	pub, priv, err := GenKeyPair()
-	err = ioutil.WriteFile(file, []byte(priv), 0600)
+	pub, priv, err := GenKeyPair(keyType, bits)
 	if err != nil {
-		return "", "", fmt.Errorf("Failed to write file - %s", err)
+		return "", "", err
 	}
-	err = ioutil.WriteFile(file+".pub", []byte(pub), 0644)
+	err = writeKeyPair(file, pub, priv)
 	if err != nil {
-		return "", "", fmt.Errorf("Failed to write pub file - %s", err)
+		return "", "", err
 	}
 
 	return pub, priv, nil
 }
 
-func GenKeyPair() (string, string, error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// ReadKeyPair reads an existing private key and the public key beside it and
+// makes sure both are valid and belong together
+func ReadKeyPair(file string) (string, string, error) {
+	priv, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to read SSH private key '%s' - %s", file, err)
+	}
+	signer, err := ssh.ParsePrivateKey(priv)
+	if err != nil {
+		return "", "", fmt.Errorf("SSH private key '%s' is not valid - %s", file, err)
+	}
+
+	pub, err := ioutil.ReadFile(file + ".pub")
+	if err != nil {
+		return "", "", fmt.Errorf("SSH public key '%s.pub' of the given private key is missing - %s", file, err)
+	}
+	public, _, _, _, err := ssh.ParseAuthorizedKey(pub)
+	if err != nil {
+		return "", "", fmt.Errorf("SSH public key '%s.pub' is not valid - %s", file, err)
+	}
+	if !bytes.Equal(public.Marshal(), signer.PublicKey().Marshal()) {
+		return "", "", fmt.Errorf("SSH public key '%s.pub' does not belong to the private key", file)
+	}
+
+	return string(pub), string(priv), nil
+}
+
+// writeKeyPair saves the private key to file and the public key to file.pub
+func writeKeyPair(file string, pub string, priv string) error {
+	err := ioutil.WriteFile(file, []byte(priv), 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to write file - %s", err)
+	}
+	err = ioutil.WriteFile(file+".pub", []byte(pub), 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write pub file - %s", err)
+	}
+	return nil
+}
+
+// GenKeyPair generates a new key pair of the given type (rsa or ed25519) and
+// returns the public key in authorized_keys format and the PEM encoded private key.
+// bits is the size of RSA keys and ignored for ed25519.
+func GenKeyPair(keyType string, bits int) (string, string, error) {
+	if keyType == "ed25519" {
+		return genEd25519KeyPair()
+	}
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return "", "", err
 	}
@@ -822,3 +4049,23 @@ func GenKeyPair() (string, string, error) {
 	public := ssh.MarshalAuthorizedKey(pub)
 	return string(public), private.String(), nil
 }
+
+func genEd25519KeyPair() (string, string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	privateKeyPEM, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		return "", "", err
+	}
+
+	pub, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	public := ssh.MarshalAuthorizedKey(pub)
+	return string(public), string(pem.EncodeToMemory(privateKeyPEM)), nil
+}
@@ -0,0 +1,2991 @@
+package proxmoxve
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/labstack/gommon/log"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/resty.v1"
+)
+
+// newTestAPI returns an API connection talking to the given handler
+func newTestAPI(t *testing.T, handler http.HandlerFunc) (*ProxmoxVE, *httptest.Server) {
+	server := httptest.NewTLSServer(handler)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := resty.New()
+	client.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	return &ProxmoxVE{Host: u.Hostname(), Port: port, client: client}, server
+}
+
+// newTestDriver returns a driver ready to create VM 100 on node pve
+func newTestDriver(api *ProxmoxVE) *Driver {
+	return &Driver{
+		BaseDriver:      &drivers.BaseDriver{MachineName: "test"},
+		driver:          api,
+		Node:            "pve",
+		Storage:         "local-lvm",
+		StorageType:     "raw",
+		RootDiskStorage: "local-lvm",
+		StorageFilename: "vm-100-disk-0",
+		VMID:            "100",
+		DiskSize:        "16",
+		DiskBus:         "scsi",
+		Bios:            "seabios",
+		OsType:          "l26",
+		KVM:             true,
+		AgentFreezeFs:   true,
+		NetModel:        "virtio",
+		NetBridge:       "vmbr0",
+		NoAgent:         true,
+	}
+}
+
+func TestConnectionInfoRedactsPassword(t *testing.T) {
+	d := &Driver{
+		Host:     "pve.example.com",
+		User:     "root",
+		Realm:    "pam",
+		Password: "Sup3rS3cret!",
+	}
+
+	info := d.connectionInfo()
+	if strings.Contains(info, d.Password) {
+		t.Errorf("connection info '%s' must not contain the password", info)
+	}
+}
+
+func TestConnectionInfoRedactsTokenSecret(t *testing.T) {
+	d := &Driver{
+		Host:           "pve.example.com",
+		APITokenID:     "root@pam!docker",
+		APITokenSecret: "6f1f0e7c-3c2b-4a63-9b1e-0c3a1f2d4e5b",
+	}
+
+	info := d.connectionInfo()
+	if strings.Contains(info, d.APITokenSecret) {
+		t.Errorf("connection info '%s' must not contain the token secret", info)
+	}
+}
+
+func TestTLSConfigInvalidCAFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "proxmoxve-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not a certificate")
+	f.Close()
+
+	d := &Driver{CAFile: f.Name()}
+	if _, err := d.tlsConfig(); err == nil {
+		t.Error("expected an error for a CA file without certificates")
+	}
+
+	d.CAFile = f.Name() + ".missing"
+	if _, err := d.tlsConfig(); err == nil {
+		t.Error("expected an error for a missing CA file")
+	}
+}
+
+func TestConnectAPIError(t *testing.T) {
+	d := newTestDriver(nil)
+	d.CAFile = "/nonexistent/proxmoxve-ca.pem"
+	if _, err := d.GetIP(); err == nil {
+		t.Error("expected GetIP to return the error of a missing CA file")
+	}
+
+	d = newTestDriver(nil)
+	d.Host = "127.0.0.1"
+	d.APITokenID = "root@pam!docker"
+	for i := 0; i < 2; i++ {
+		if err := d.connectAPI(); err == nil || d.driver != nil {
+			t.Errorf("expected a failed connection to leave no client behind, got %v", err)
+		}
+	}
+}
+
+func TestIPConfig(t *testing.T) {
+	tests := []struct {
+		address, netmask, gateway string
+		expected                  string
+	}{
+		{"10.0.0.5/24", "", "", "ip=10.0.0.5/24"},
+		{"10.0.0.5", "24", "10.0.0.1", "ip=10.0.0.5/24,gw=10.0.0.1"},
+		{"10.0.0.5", "255.255.255.0", "10.0.0.1", "ip=10.0.0.5/24,gw=10.0.0.1"},
+		{"2001:db8::5/64", "", "2001:db8::1", "ip6=2001:db8::5/64,gw6=2001:db8::1"},
+		{"2001:db8::5", "64", "", "ip6=2001:db8::5/64"},
+	}
+	for _, tt := range tests {
+		d := &Driver{StaticIPAddress: tt.address, StaticNetmask: tt.netmask, StaticGateway: tt.gateway}
+		config, err := d.ipConfig()
+		if err != nil {
+			t.Errorf("unexpected error for '%s': %s", tt.address, err)
+			continue
+		}
+		if config != tt.expected {
+			t.Errorf("expected '%s', but got '%s'", tt.expected, config)
+		}
+	}
+
+	for _, d := range []*Driver{
+		{StaticIPAddress: "10.0.0.5"},
+		{StaticIPAddress: "10.0.0.500/24"},
+		{StaticIPAddress: "10.0.0.5/24", StaticGateway: "gateway"},
+		{StaticIPAddress: "2001:db8::5/64", StaticGateway: "10.0.0.1"},
+	} {
+		if _, err := d.ipConfig(); err == nil {
+			t.Errorf("expected an error for '%s'", d.StaticIPAddress)
+		}
+	}
+}
+
+func TestNetConfig(t *testing.T) {
+	d := &Driver{NetModel: "virtio", NetBridge: "vmbr0"}
+	if net := d.netConfig(); net != "virtio,bridge=vmbr0" {
+		t.Errorf("unexpected untagged net config '%s'", net)
+	}
+
+	d.NetVlanTag = 100
+	if net := d.netConfig(); net != "virtio,bridge=vmbr0,tag=100" {
+		t.Errorf("unexpected tagged net config '%s'", net)
+	}
+
+	d.NetQueues = 4
+	if net := d.netConfig(); net != "virtio,bridge=vmbr0,tag=100,queues=4" {
+		t.Errorf("unexpected multiqueue net config '%s'", net)
+	}
+
+	d = &Driver{NetModel: "e1000", NetBridge: "vmbr1", NetMacAddr: "BC:24:11:00:00:01"}
+	if net := d.netConfig(); net != "e1000=BC:24:11:00:00:01,bridge=vmbr1" {
+		t.Errorf("unexpected net config with MAC address '%s'", net)
+	}
+
+	d.NetRate = "12.5"
+	if net := d.netConfig(); net != "e1000=BC:24:11:00:00:01,bridge=vmbr1,rate=12.5" {
+		t.Errorf("unexpected rate limited net config '%s'", net)
+	}
+
+	d.Firewall = true
+	if net := d.netConfig(); net != "e1000=BC:24:11:00:00:01,bridge=vmbr1,rate=12.5,firewall=1" {
+		t.Errorf("unexpected net config with firewall '%s'", net)
+	}
+}
+
+func TestMacAddrRegexp(t *testing.T) {
+	for _, mac := range []string{"BC:24:11:00:00:01", "02:00:00:AB:CD:EF"} {
+		if !pveMacAddrRegexp.MatchString(mac) {
+			t.Errorf("MAC address %q should be valid", mac)
+		}
+	}
+	for _, mac := range []string{"", "BC:24:11:00:00", "BC-24-11-00-00-01", "01:00:5E:00:00:01", "BC:24:11:00:00:0G"} {
+		if pveMacAddrRegexp.MatchString(mac) {
+			t.Errorf("MAC address %q should be invalid", mac)
+		}
+	}
+}
+
+func TestNetConfigs(t *testing.T) {
+	d := &Driver{NetModel: "virtio", NetBridge: "vmbr0"}
+	if nets := d.netConfigs(); len(nets) != 1 || nets[0] != "virtio,bridge=vmbr0" {
+		t.Errorf("expected the bridge flags on net0, got %v", nets)
+	}
+
+	d.Networks = []string{"model=virtio,bridge=vmbr0", "model=e1000,bridge=vmbr1,tag=20"}
+	nets := d.netConfigs()
+	if len(nets) != 2 || nets[1] != "model=e1000,bridge=vmbr1,tag=20" {
+		t.Errorf("expected the repeated net flags, got %v", nets)
+	}
+}
+
+func TestCheckNetworks(t *testing.T) {
+	d := newTestDriver(nil)
+	d.NetQueues = 4
+	d.Firewall = true
+	if err := d.checkNetworks(); err != nil {
+		t.Errorf("expected the net0 flags without --%s to be accepted, got %v", pveNetParameter, err)
+	}
+
+	for _, setup := range []func(d *Driver){
+		func(d *Driver) { d.NetVlanTag = 20 },
+		func(d *Driver) { d.NetQueues = 4 },
+		func(d *Driver) { d.NetMacAddr = "BC:24:11:00:00:01" },
+		func(d *Driver) { d.NetRate = "12.5" },
+		func(d *Driver) { d.Firewall = true },
+	} {
+		d := newTestDriver(nil)
+		d.Networks = []string{"model=virtio,bridge=vmbr0"}
+		setup(d)
+		err := d.checkNetworks()
+		if err == nil || !strings.Contains(err.Error(), "--"+pveNetParameter) {
+			t.Errorf("expected the net0 flag to be rejected next to --%s, got %v", pveNetParameter, err)
+		}
+	}
+}
+
+func TestDiskConfig(t *testing.T) {
+	d := &Driver{}
+	if disk := d.diskConfig("local-lvm:vm-100-disk-0,size=16G"); disk != "local-lvm:vm-100-disk-0,size=16G" {
+		t.Errorf("unexpected disk config without options '%s'", disk)
+	}
+
+	d.DiskCache = "writeback"
+	d.DiskSSD = true
+	d.DiskDiscard = true
+	disk := d.diskConfig("local-lvm:vm-100-disk-0,size=16G")
+	for _, option := range []string{",cache=writeback", ",ssd=1", ",discard=on"} {
+		if !strings.Contains(disk, option) {
+			t.Errorf("disk config '%s' is missing '%s'", disk, option)
+		}
+	}
+}
+
+func TestExtraDisks(t *testing.T) {
+	d := &Driver{Storage: "local-lvm", DiskBus: "scsi", ExtraDisks: []string{"size=50G", "size=100,storage=ceph,bus=virtio"}}
+	disks, err := d.extraDisks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disks) != 2 {
+		t.Fatalf("expected 2 extra disks, got %d", len(disks))
+	}
+	if disks[0] != (extraDisk{size: "50G", storage: "local-lvm", bus: "scsi"}) {
+		t.Errorf("unexpected first extra disk %+v", disks[0])
+	}
+	if disks[1] != (extraDisk{size: "100G", storage: "ceph", bus: "virtio"}) {
+		t.Errorf("unexpected second extra disk %+v", disks[1])
+	}
+
+	for _, spec := range []string{"storage=local-lvm", "size=big", "size=10G,bus=floppy", "size=10G,iothread=1"} {
+		d.ExtraDisks = []string{spec}
+		if _, err := d.extraDisks(); err == nil {
+			t.Errorf("expected an error for extra disk '%s'", spec)
+		}
+	}
+}
+
+func TestNextDiskKey(t *testing.T) {
+	devices := map[string]string{"scsi0": "local-lvm:vm-100-disk-0", "ide0": "local:iso/b2d.iso,media=cdrom"}
+	if key, _ := nextDiskKey("scsi", devices); key != "scsi1" {
+		t.Errorf("expected scsi1, got '%s'", key)
+	}
+	if key, _ := nextDiskKey("ide", devices); key != "ide1" {
+		t.Errorf("expected ide1, got '%s'", key)
+	}
+
+	devices["ide1"] = "local-lvm:vm-100-disk-1"
+	if key, _ := nextDiskKey("ide", devices); key != "ide3" {
+		t.Errorf("expected ide2 to be skipped, got '%s'", key)
+	}
+}
+
+func TestMachineTypeRegexp(t *testing.T) {
+	for _, machine := range []string{"pc", "q35", "pc-q35-7.2", "pc-i440fx-8.0", "pc-q35-8.1+pve0"} {
+		if !pveMachineTypeRegexp.MatchString(machine) {
+			t.Errorf("machine type '%s' should be valid", machine)
+		}
+	}
+	for _, machine := range []string{"q35 ", "pc-q35", "virt", "q35;reboot"} {
+		if pveMachineTypeRegexp.MatchString(machine) {
+			t.Errorf("machine type '%s' should be invalid", machine)
+		}
+	}
+}
+
+func TestCpuConfig(t *testing.T) {
+	tests := []struct {
+		cpuType        string
+		pcid, specCtrl bool
+		expected       string
+	}{
+		{"", false, false, ""},
+		{"host", false, false, "host"},
+		{"host", true, false, "host,flags=+pcid"},
+		{"", true, true, "kvm64,flags=+pcid;+spec-ctrl"},
+		{"x86-64-v2-AES,flags=+aes", false, true, "x86-64-v2-AES,flags=+aes;+spec-ctrl"},
+	}
+	for _, tt := range tests {
+		d := &Driver{CpuType: tt.cpuType, Pcid: tt.pcid, SpecCtrl: tt.specCtrl}
+		if cpu := d.cpuConfig(); cpu != tt.expected {
+			t.Errorf("expected '%s', but got '%s'", tt.expected, cpu)
+		}
+	}
+}
+
+func TestMemorySizeMB(t *testing.T) {
+	if mb := memorySizeMB(8, 0); mb != 8192 {
+		t.Errorf("expected 8 GB to be 8192 MB, got %d", mb)
+	}
+	if mb := memorySizeMB(8, 1536); mb != 1536 {
+		t.Errorf("expected the MB flag to take precedence, got %d", mb)
+	}
+}
+
+func TestCheckDisplay(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stdout)
+
+	d := &Driver{Vga: "none"}
+	if err := d.checkDisplay(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "no display and no serial console") {
+		t.Errorf("expected a warning for a headless VM, got %q", out.String())
+	}
+
+	out.Reset()
+	d.Serial = true
+	if err := d.checkDisplay(); err != nil || out.Len() != 0 {
+		t.Errorf("expected no warning with a serial console, got %v, %q", err, out.String())
+	}
+
+	d = &Driver{Vga: "serial0"}
+	if err := d.checkDisplay(); err == nil {
+		t.Error("expected serial0 without a serial console to be rejected")
+	}
+	d = &Driver{Vga: "vga"}
+	if err := d.checkDisplay(); err == nil {
+		t.Error("expected an unknown display type to be rejected")
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	log.SetLevel(log.DEBUG)
+	defer func() {
+		log.SetOutput(os.Stdout)
+		log.SetLevel(log.INFO)
+	}()
+
+	d := &Driver{}
+	d.debugf("hidden %d", 1)
+	if out.Len() != 0 {
+		t.Errorf("expected no debug output without --%s, got %q", pveDriverDebugParameter, out.String())
+	}
+
+	d.driverDebug = true
+	d.debugf("shown %d", 2)
+	d.warnf("careful %d", 3)
+	d.errorf("broken %d", 4)
+	for _, want := range []string{`"level":"DEBUG"`, "shown 2", `"level":"WARN"`, "careful 3", `"level":"ERROR"`, "broken 4"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the log, got %q", want, out.String())
+		}
+	}
+}
+
+func TestCheckIntRange(t *testing.T) {
+	for _, value := range []string{"1", "4"} {
+		if err := checkIntRange(pveCpuSocketsParameter, value, 1, 4); err != nil {
+			t.Errorf("unexpected error for '%s': %s", value, err)
+		}
+	}
+	for _, value := range []string{"", "0", "5", "four", "2.5"} {
+		if err := checkIntRange(pveCpuSocketsParameter, value, 1, 4); err == nil {
+			t.Errorf("expected an error for '%s'", value)
+		}
+	}
+}
+
+func TestCreateVMRemovesVolumeOnFailure(t *testing.T) {
+	var removed []string
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/storage/local-lvm/content":
+			w.Write([]byte(`{"data":"local-lvm:vm-100-disk-0"}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu":
+			http.Error(w, `{"data":null}`, http.StatusInternalServerError)
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api2/json/nodes/pve/storage/local-lvm/content/"):
+			removed = append(removed, strings.TrimPrefix(r.URL.Path, "/api2/json/nodes/pve/storage/local-lvm/content/"))
+			w.Write([]byte(`{"data":null}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	if err := d.createVM(); err == nil {
+		t.Fatal("expected createVM to fail")
+	}
+	if len(removed) != 1 || removed[0] != "vm-100-disk-0" {
+		t.Errorf("expected the allocated volume to be removed, removed %v", removed)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var userAgent string
+	_, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Write([]byte(`{"data":{"version":"8.2.2","release":"8.2"}}`))
+	})
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+	_, err := GetProxmoxVEConnection(&ProxmoxVE{Host: u.Hostname(), Port: port, TokenID: "root@pam!test", tokenSecret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "docker-machine-driver-proxmoxve/" + DriverVersion; userAgent != want {
+		t.Errorf("User-Agent = %q, want %q", userAgent, want)
+	}
+}
+
+func TestGetInterfaceIPv4(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"result":[
+			{"name":"lo","ip-addresses":[{"ip-address":"127.0.0.1","ip-address-type":"ipv4","prefix":8}]},
+			{"name":"ens18","ip-addresses":[
+				{"ip-address":"169.254.10.1","ip-address-type":"ipv4","prefix":16},
+				{"ip-address":"fe80::1","ip-address-type":"ipv6","prefix":64},
+				{"ip-address":"192.168.1.10","ip-address-type":"ipv4","prefix":24}]},
+			{"name":"ens19","ip-addresses":[{"ip-address":"10.0.0.5","ip-address-type":"ipv4","prefix":8}]}
+		]}}`)
+	})
+	defer server.Close()
+
+	tests := []struct {
+		ifname string
+		want   string
+	}{
+		{"", "192.168.1.10"},
+		{"ens18", "192.168.1.10"},
+		{"ens19", "10.0.0.5"},
+		{"eth0", ""},
+	}
+	for _, tt := range tests {
+		got, err := api.GetInterfaceIPv4("pve", "100", tt.ifname)
+		if err != nil {
+			t.Fatalf("GetInterfaceIPv4(%q) failed: %v", tt.ifname, err)
+		}
+		if got != tt.want {
+			t.Errorf("GetInterfaceIPv4(%q) = %q, want %q", tt.ifname, got, tt.want)
+		}
+	}
+}
+
+func TestGetInterfaceIPIPAMFallback(t *testing.T) {
+	leases := `[{"mac":"bc:24:11:00:00:01","ip":"10.0.0.20","vnet":"vnet0","zone":"dhcp"},{"ip":"10.0.0.1","vnet":"vnet0","zone":"dhcp"}]`
+	agentStatus := http.StatusInternalServerError
+	ipamStatus := http.StatusOK
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api2/json/nodes/pve/qemu/100/agent":
+			http.Error(w, `{"data":null,"message":"QEMU guest agent is not running\n"}`, agentStatus)
+		case "/api2/json/nodes/pve/qemu/100/config":
+			w.Write([]byte(`{"data":{"name":"test","net0":"virtio=BC:24:11:00:00:01,bridge=vnet0"}}`))
+		case "/api2/json/cluster/sdn/vnets/vnet0":
+			w.Write([]byte(`{"data":{"vnet":"vnet0","zone":"dhcp"}}`))
+		case "/api2/json/cluster/sdn/zones/dhcp":
+			w.Write([]byte(`{"data":{"zone":"dhcp","type":"simple","ipam":"netbox"}}`))
+		case "/api2/json/cluster/sdn/ipams/netbox/status":
+			if ipamStatus != http.StatusOK {
+				http.Error(w, `{"data":null}`, ipamStatus)
+				return
+			}
+			fmt.Fprintf(w, `{"data":%s}`, leases)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	got, err := api.GetInterfaceIPv4("pve", "100", "")
+	if err != nil || got != "10.0.0.20" {
+		t.Errorf("expected the lease of the zone's IPAM, got %q, %v", got, err)
+	}
+
+	leases = `[]`
+	_, err = api.GetInterfaceIPv4("pve", "100", "")
+	if err == nil || !strings.Contains(err.Error(), "not yet available (agent not running)") {
+		t.Errorf("expected an error without agent and lease, got %v", err)
+	}
+
+	ipamStatus = http.StatusForbidden
+	_, err = api.GetInterfaceIPv4("pve", "100", "")
+	if err == nil || !strings.Contains(err.Error(), "IPAM lookup failed") {
+		t.Errorf("expected the IPAM error, got %v", err)
+	}
+
+	// missing permissions are no reason to look elsewhere
+	agentStatus = http.StatusForbidden
+	_, err = api.GetInterfaceIPv4("pve", "100", "")
+	if err == nil || strings.Contains(err.Error(), "agent not running") {
+		t.Errorf("expected the agent error without IPAM fallback, got %v", err)
+	}
+}
+
+func TestNicMAC(t *testing.T) {
+	tests := map[string]string{
+		"virtio=BC:24:11:00:00:01,bridge=vmbr0,firewall=1": "BC:24:11:00:00:01",
+		"model=e1000,macaddr=BC:24:11:00:00:02":            "BC:24:11:00:00:02",
+		"bridge=vmbr0":                                     "",
+	}
+	for device, want := range tests {
+		if got := nicMAC(device); got != want {
+			t.Errorf("nicMAC(%q) = %q, want %q", device, got, want)
+		}
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	memory := `4096`
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/nodes/pve/qemu/100/config" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"data":{"name":"test","memory":%s,"cores":2,"sockets":"1",
+			"net0":"virtio=BC:24:11:00:00:01,bridge=vmbr0,firewall=1,tag=20",
+			"scsi0":"local-lvm:vm-100-disk-0,cache=writeback,discard=on,size=16G"}}`, memory)
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	config, err := d.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mb, err := config.MemoryMB(); err != nil || mb != 4096 {
+		t.Errorf("MemoryMB() = %d, %v", mb, err)
+	}
+	if config.Cores != "2" || config.Sockets != "1" {
+		t.Errorf("cores %q, sockets %q", config.Cores, config.Sockets)
+	}
+
+	nic := ParseQemuNetDevice(config.Net0)
+	if nic.Model != "virtio" || nic.MACAddress != "BC:24:11:00:00:01" || nic.Bridge != "vmbr0" || nic.Tag != 20 || !nic.Firewall {
+		t.Errorf("net0 parsed as %+v", nic)
+	}
+
+	disk := ParseQemuDiskDevice(config.Scsi0)
+	if disk.Volume != "local-lvm:vm-100-disk-0" || disk.Size != "16G" || disk.Options["cache"] != "writeback" {
+		t.Errorf("scsi0 parsed as %+v", disk)
+	}
+
+	// Proxmox VE 8.1 and later return memory as property string
+	memory = `"current=2048"`
+	config, err = d.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mb, err := config.MemoryMB(); err != nil || mb != 2048 {
+		t.Errorf("MemoryMB() = %d, %v", mb, err)
+	}
+}
+
+func TestGetState(t *testing.T) {
+	status := `{"status":"running","qmpstatus":"paused"}`
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/nodes/pve/qemu/100/status/current" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"data":%s}`, status)
+	})
+
+	d := newTestDriver(api)
+	st, err := d.GetState()
+	if err != nil || st != state.Paused {
+		t.Errorf("GetState() = %s, %v, want Paused", st, err)
+	}
+
+	status = `{"status":"unknown"}`
+	st, err = d.GetState()
+	if err == nil || st != state.Error {
+		t.Errorf("GetState() = %s, %v, want Error for an unknown status", st, err)
+	}
+
+	// the API is down, this must not look like a paused VM
+	server.Close()
+	st, err = d.GetState()
+	if err == nil || st != state.Error {
+		t.Errorf("GetState() = %s, %v, want Error with the API down", st, err)
+	}
+
+	d = &Driver{BaseDriver: &drivers.BaseDriver{}, Host: server.Listener.Addr().(*net.TCPAddr).IP.String(),
+		Port: server.Listener.Addr().(*net.TCPAddr).Port, User: "root", Realm: "pam", Password: "secret"}
+	st, err = d.GetState()
+	if err == nil || st != state.Error || !strings.Contains(err.Error(), "could not connect to Proxmox VE") {
+		t.Errorf("GetState() = %s, %v, want Error when the connection fails", st, err)
+	}
+}
+
+func TestWaitForIP(t *testing.T) {
+	calls := 0
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// network not configured yet, only a link-local address
+			fmt.Fprint(w, `{"data":{"result":[{"name":"ens18","ip-addresses":[
+				{"ip-address":"169.254.10.1","ip-address-type":"ipv4","prefix":16}]}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"result":[{"name":"ens18","ip-addresses":[
+			{"ip-address":"192.0.2.10","ip-address-type":"ipv4","prefix":24}]}]}}`)
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ProvisionTimeout = 10
+	ip, err := d.waitForIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "192.0.2.10" || calls != 2 {
+		t.Errorf("waitForIP() = %q after %d calls", ip, calls)
+	}
+}
+
+func TestWaitForIPTimeout(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"result":[]}}`)
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ProvisionTimeout = 1
+	_, err := d.waitForIP()
+	if err == nil || !strings.Contains(err.Error(), "did not report a routable IP address within 1s") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
+
+func TestGetInterfaceIPv6(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"result":[
+			{"name":"lo","ip-addresses":[{"ip-address":"::1","ip-address-type":"ipv6","prefix":128}]},
+			{"name":"ens18","ip-addresses":[
+				{"ip-address":"fe80::1","ip-address-type":"ipv6","prefix":64},
+				{"ip-address":"2001:db8::10","ip-address-type":"ipv6","prefix":64}]}
+		]}}`)
+	})
+	defer server.Close()
+
+	got, err := api.GetInterfaceIPv6("pve", "100", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "2001:db8::10" {
+		t.Errorf("GetInterfaceIPv6() = %q, want %q", got, "2001:db8::10")
+	}
+
+	d := newTestDriver(api)
+	d.IPFamily = pveIPFamilyAuto
+	url, err := d.GetURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "tcp://[2001:db8::10]:2376" {
+		t.Errorf("GetURL() = %q, want %q", url, "tcp://[2001:db8::10]:2376")
+	}
+	host, err := d.GetSSHHostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "[2001:db8::10]" {
+		t.Errorf("GetSSHHostname() = %q, want %q", host, "[2001:db8::10]")
+	}
+}
+
+func TestTicketValid(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		ticket string
+		expiry time.Time
+		want   bool
+	}{
+		{"no ticket", "", now.Add(time.Hour), false},
+		{"fresh", "PVE:root@pam:1234", now.Add(time.Hour), true},
+		{"within renew margin", "PVE:root@pam:1234", now.Add(30 * time.Second), false},
+		{"expired", "PVE:root@pam:1234", now.Add(-time.Minute), false},
+	}
+	for _, tt := range tests {
+		p := ProxmoxVE{Ticket: tt.ticket, CSRFPreventionToken: "csrf", TicketExpiry: tt.expiry}
+		if got := p.ticketValid(now); got != tt.want {
+			t.Errorf("%s: ticketValid() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConnectReusesCachedTicket(t *testing.T) {
+	logins := 0
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api2/json/access/ticket":
+			logins++
+			fmt.Fprint(w, `{"data":{"ticket":"new","CSRFPreventionToken":"csrf"}}`)
+		case "/api2/json/version":
+			fmt.Fprint(w, `{"data":{"version":"6.2"}}`)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(nil)
+	d.Host = api.Host
+	d.Port = api.Port
+	d.User = "root"
+	d.Realm = "pam"
+	d.Password = "secret"
+	d.InsecureTLS = true
+	d.APITicket = "cached"
+	d.APICSRFPreventionToken = "csrf"
+	d.APITicketExpiry = time.Now().Add(time.Hour)
+
+	if err := d.connectAPI(); err != nil {
+		t.Fatal(err)
+	}
+	if logins != 0 || d.APITicket != "cached" {
+		t.Errorf("valid cached ticket was not reused, %d logins", logins)
+	}
+
+	d.driver = nil
+	d.APITicketExpiry = time.Now().Add(30 * time.Second)
+	if err := d.connectAPI(); err != nil {
+		t.Fatal(err)
+	}
+	if logins != 1 || d.APITicket != "new" {
+		t.Errorf("expiring ticket was not renewed, %d logins", logins)
+	}
+	if !d.APITicketExpiry.After(time.Now().Add(time.Hour)) {
+		t.Errorf("renewed ticket expiry %s was not stored", d.APITicketExpiry)
+	}
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	calls := 0
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(596)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"status":"stopped","exitstatus":"OK"}}`)
+	})
+	defer server.Close()
+	api.Retries = 3
+
+	if _, err := api.NodesNodeTasksUPIDStatusGet("pve", "UPID:pve"); err != nil {
+		t.Fatalf("GET was not retried: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	calls = 0
+	if _, err := api.NodesNodeQemuPost("pve", &NodesNodeQemuPostParameter{}); err == nil {
+		t.Error("expected the create POST to fail")
+	}
+	if calls != 1 {
+		t.Errorf("create POST must not be retried, got %d calls", calls)
+	}
+}
+
+func TestRetryPermanentFailure(t *testing.T) {
+	calls := 0
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+	})
+	defer server.Close()
+	api.Retries = 3
+
+	if _, err := api.NodesNodeTasksUPIDStatusGet("pve", "UPID:pve"); err == nil {
+		t.Error("expected the GET to fail")
+	}
+	if calls != 1 {
+		t.Errorf("client errors must not be retried, got %d calls", calls)
+	}
+}
+
+func TestRetryDecodeError(t *testing.T) {
+	calls := 0
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"data":`))
+	})
+	defer server.Close()
+	api.Retries = 3
+
+	if _, err := api.NodesNodeTasksUPIDStatusGet("pve", "UPID:pve"); err == nil {
+		t.Error("expected the GET to fail")
+	}
+	if calls != 1 {
+		t.Errorf("decode errors must not be retried, got %d calls", calls)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	for _, err := range []error{
+		&apiError{code: 596},
+		&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+		fmt.Errorf("Get https://pve:8006/api2/json/version: %w", syscall.ECONNRESET),
+	} {
+		if !transient(err) {
+			t.Errorf("expected %v to be retried", err)
+		}
+	}
+	for _, err := range []error{
+		&apiError{code: 400},
+		context.DeadlineExceeded,
+		fmt.Errorf("Get https://pve:8006/api2/json/version: %w", context.Canceled),
+		errors.New("x509: certificate signed by unknown authority"),
+		&net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")},
+	} {
+		if transient(err) {
+			t.Errorf("expected %v not to be retried", err)
+		}
+	}
+}
+
+func TestFindNodeWithMostFreeMemory(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") != "node" {
+			t.Errorf("unexpected query '%s'", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"data":[
+			{"id":"node/pve1","type":"node","node":"pve1","status":"online","mem":6000,"maxmem":8000},
+			{"id":"node/pve2","type":"node","node":"pve2","status":"online","mem":2000,"maxmem":8000},
+			{"id":"node/pve3","type":"node","node":"pve3","status":"offline","mem":0,"maxmem":16000}
+		]}`)
+	})
+	defer server.Close()
+
+	node, err := api.FindNodeWithMostFreeMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node != "pve2" {
+		t.Errorf("FindNodeWithMostFreeMemory() = %q, want %q", node, "pve2")
+	}
+}
+
+// createVMForm runs createVM against a fake API and returns the form data of the create request
+func createVMForm(t *testing.T, setup func(d *Driver)) url.Values {
+	var form url.Values
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/storage/local-lvm/content":
+			w.Write([]byte(`{"data":"local-lvm:vm-100-disk-0"}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu":
+			r.ParseForm()
+			form = r.PostForm
+			w.Write([]byte(`{"data":""}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	if setup != nil {
+		setup(d)
+	}
+	if err := d.createVM(); err != nil {
+		t.Fatal(err)
+	}
+	return form
+}
+
+func TestCreateVMDescription(t *testing.T) {
+	form := createVMForm(t, nil)
+	if got := form.Get("description"); got != "Created by docker-machine: test" {
+		t.Errorf("default description = %q", got)
+	}
+
+	form = createVMForm(t, func(d *Driver) {
+		d.Description = "owner: ops & co\nticket: #42"
+	})
+	if got := form.Get("description"); got != "owner: ops & co\nticket: #42" {
+		t.Errorf("description = %q", got)
+	}
+}
+
+func TestCreateVMName(t *testing.T) {
+	if got := createVMForm(t, nil).Get("name"); got != "test" {
+		t.Errorf("name = %q, want the machine name", got)
+	}
+	form := createVMForm(t, func(d *Driver) { d.VMName = "docker-01.example.com" })
+	if got := form.Get("name"); got != "docker-01.example.com" {
+		t.Errorf("name = %q, want docker-01.example.com", got)
+	}
+}
+
+func TestDNSNameRegexp(t *testing.T) {
+	for _, name := range []string{"docker", "docker-01", "docker-01.example.com", "a"} {
+		if !pveDNSNameRegexp.MatchString(name) {
+			t.Errorf("VM name %q should be valid", name)
+		}
+	}
+	for _, name := range []string{"", "docker_01", "-docker", "docker-", "docker..example", "docker.example."} {
+		if pveDNSNameRegexp.MatchString(name) {
+			t.Errorf("VM name %q should be invalid", name)
+		}
+	}
+}
+
+func TestTagRegexp(t *testing.T) {
+	for _, tag := range []string{"rancher", "env-prod", "k8s_1.29"} {
+		if !pveTagRegexp.MatchString(tag) {
+			t.Errorf("tag %q should be valid", tag)
+		}
+	}
+	for _, tag := range []string{"", "Prod", "a;b", "with space", "ümlaut"} {
+		if pveTagRegexp.MatchString(tag) {
+			t.Errorf("tag %q should be invalid", tag)
+		}
+	}
+}
+
+func TestCreateVMTags(t *testing.T) {
+	form := createVMForm(t, func(d *Driver) {
+		d.Tags = []string{"rancher", "env-prod"}
+	})
+	if got := form.Get("tags"); got != "rancher;env-prod" {
+		t.Errorf("tags = %q, want %q", got, "rancher;env-prod")
+	}
+}
+
+func TestParseBoolFlag(t *testing.T) {
+	for value, want := range map[string]bool{"1": true, "true": true, "0": false, "false": false} {
+		got, err := parseBoolFlag(pveOnbootParameter, value)
+		if err != nil || got != want {
+			t.Errorf("parseBoolFlag(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseBoolFlag(pveOnbootParameter, "maybe"); err == nil {
+		t.Error("expected an error for 'maybe'")
+	}
+}
+
+func TestCreateVMOnboot(t *testing.T) {
+	form := createVMForm(t, func(d *Driver) { d.Onboot = true })
+	if got := form.Get("onboot"); got != "1" {
+		t.Errorf("onboot = %q, want 1", got)
+	}
+	form = createVMForm(t, nil)
+	if got := form.Get("onboot"); got != "0" {
+		t.Errorf("onboot = %q, want 0", got)
+	}
+}
+
+func TestReachableWithoutAgent(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	d := newTestDriver(nil)
+	d.NoAgent = true
+	d.StaticIPAddress = "127.0.0.1/8"
+	d.SSHPort = port
+	if !d.reachable() {
+		t.Error("expected the SSH port to be reachable")
+	}
+
+	l.Close()
+	if d.reachable() {
+		t.Error("expected the closed SSH port to be unreachable")
+	}
+}
+
+func TestCreateVMAgent(t *testing.T) {
+	form := createVMForm(t, func(d *Driver) { d.NoAgent = false })
+	if got := form.Get("agent"); got != "1" {
+		t.Errorf("agent = %q, want 1", got)
+	}
+	form = createVMForm(t, nil)
+	if got := form.Get("agent"); got != "0" {
+		t.Errorf("agent = %q, want 0", got)
+	}
+}
+
+func TestAgentConfig(t *testing.T) {
+	d := &Driver{AgentFreezeFs: true}
+	if agent := d.agentConfig(); agent != "1" {
+		t.Errorf("unexpected agent config with defaults '%s'", agent)
+	}
+
+	d.AgentFstrim = true
+	d.AgentFreezeFs = false
+	if agent := d.agentConfig(); agent != "1,fstrim_cloned_disks=1,freeze-fs-on-backup=0" {
+		t.Errorf("unexpected agent config with sub-options '%s'", agent)
+	}
+
+	d.NoAgent = true
+	if agent := d.agentConfig(); agent != "0" {
+		t.Errorf("unexpected disabled agent config '%s'", agent)
+	}
+}
+
+func TestAgentOfOldMachines(t *testing.T) {
+	// machines created before --proxmoxve-agent have no value for it and run the agent
+	d := &Driver{}
+	if err := json.Unmarshal([]byte(`{"VMID":"100","Node":"pve"}`), d); err != nil {
+		t.Fatal(err)
+	}
+	if d.NoAgent {
+		t.Error("expected the guest agent to be used for machines created before the option")
+	}
+}
+
+func TestCreateVMOsType(t *testing.T) {
+	form := createVMForm(t, func(d *Driver) { d.OsType = "win11" })
+	if got := form.Get("ostype"); got != "win11" {
+		t.Errorf("ostype = %q, want win11", got)
+	}
+}
+
+func TestCreateVMNuma(t *testing.T) {
+	if got := createVMForm(t, nil).Get("numa"); got != "0" {
+		t.Errorf("numa = %q, want 0 by default", got)
+	}
+	form := createVMForm(t, func(d *Driver) { d.Sockets = "2"; d.Numa = true })
+	if got := form.Get("numa"); got != "1" {
+		t.Errorf("numa = %q, want 1", got)
+	}
+}
+
+func TestCreateVMCpuLimitAndUnits(t *testing.T) {
+	form := createVMForm(t, func(d *Driver) { d.CpuLimit = "0" })
+	if _, ok := form["cpulimit"]; ok {
+		t.Errorf("expected no cpulimit for an unlimited VM, got %q", form.Get("cpulimit"))
+	}
+	if _, ok := form["cpuunits"]; ok {
+		t.Errorf("expected no cpuunits by default, got %q", form.Get("cpuunits"))
+	}
+
+	form = createVMForm(t, func(d *Driver) { d.CpuLimit = "1.5"; d.CpuUnits = 200 })
+	if form.Get("cpulimit") != "1.5" || form.Get("cpuunits") != "200" {
+		t.Errorf("cpulimit = %q, cpuunits = %q, want 1.5 and 200", form.Get("cpulimit"), form.Get("cpuunits"))
+	}
+}
+
+func TestCheckCpuUnits(t *testing.T) {
+	if err := checkCpuUnits(10000, (&ProxmoxVE{Version: "8.1.4"}).GetCapabilities()); err != nil {
+		t.Error(err)
+	}
+	if err := checkCpuUnits(1024, (&ProxmoxVE{Version: "6.4-13"}).GetCapabilities()); err != nil {
+		t.Error(err)
+	}
+	if err := checkCpuUnits(20000, (&ProxmoxVE{Version: "7.0"}).GetCapabilities()); err == nil {
+		t.Error("expected an error for 20000 units on Proxmox VE 7")
+	}
+	if err := checkCpuUnits(1, (&ProxmoxVE{Version: "6.4"}).GetCapabilities()); err == nil {
+		t.Error("expected an error for 1 unit on Proxmox VE 6")
+	}
+}
+
+func TestCreateVMHotplug(t *testing.T) {
+	if _, ok := createVMForm(t, nil)["hotplug"]; ok {
+		t.Error("expected no hotplug parameter by default")
+	}
+	form := createVMForm(t, func(d *Driver) { d.Hotplug = "disk,network,cpu" })
+	if got := form.Get("hotplug"); got != "disk,network,cpu" {
+		t.Errorf("hotplug = %q, want disk,network,cpu", got)
+	}
+}
+
+func TestCreateVMRng(t *testing.T) {
+	if _, ok := createVMForm(t, nil)["rng0"]; ok {
+		t.Error("expected no RNG device by default")
+	}
+	form := createVMForm(t, func(d *Driver) { d.Rng = true })
+	if got := form.Get("rng0"); got != "source=/dev/urandom,max_bytes=1024,period=1000" {
+		t.Errorf("rng0 = %q", got)
+	}
+}
+
+func TestCreateVMKvm(t *testing.T) {
+	form := createVMForm(t, nil)
+	if got := form.Get("kvm"); got != "1" {
+		t.Errorf("kvm = %q, want 1", got)
+	}
+	form = createVMForm(t, func(d *Driver) { d.KVM = false })
+	if got := form.Get("kvm"); got != "0" {
+		t.Errorf("kvm = %q, want 0", got)
+	}
+	if got := form.Get("cpu"); got != "" {
+		t.Errorf("cpu = %q, want the Proxmox VE default", got)
+	}
+}
+
+func TestGenKeyPair(t *testing.T) {
+	for keyType, algo := range map[string]string{"rsa": ssh.KeyAlgoRSA, "ed25519": ssh.KeyAlgoED25519} {
+		pub, priv, err := GenKeyPair(keyType, 2048)
+		if err != nil {
+			t.Fatalf("%s: %v", keyType, err)
+		}
+		signer, err := ssh.ParsePrivateKey([]byte(priv))
+		if err != nil {
+			t.Fatalf("%s: private key does not parse: %v", keyType, err)
+		}
+		public, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pub))
+		if err != nil {
+			t.Fatalf("%s: public key is not in authorized_keys format: %v", keyType, err)
+		}
+		if public.Type() != algo || !bytes.Equal(public.Marshal(), signer.PublicKey().Marshal()) {
+			t.Errorf("%s: public key %s does not match the private key", keyType, public.Type())
+		}
+	}
+}
+
+func TestGenKeyPairRSABits(t *testing.T) {
+	_, priv, err := GenKeyPair("rsa", 3072)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.ParseRawPrivateKey([]byte(priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits := key.(*rsa.PrivateKey).N.BitLen(); bits != 3072 {
+		t.Errorf("generated a %d bit key, want 3072", bits)
+	}
+}
+
+func TestReadKeyPair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxmoxve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := dir + "/id_ed25519"
+	pub, priv, err := GenKeyPair("ed25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKeyPair(file, pub, priv); err != nil {
+		t.Fatal(err)
+	}
+
+	gotPub, gotPriv, err := ReadKeyPair(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPub != pub || gotPriv != priv {
+		t.Error("ReadKeyPair did not return the written key pair")
+	}
+
+	otherPub, _, err := GenKeyPair("ed25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(file+".pub", []byte(otherPub), 0644)
+	if _, _, err := ReadKeyPair(file); err == nil || !strings.Contains(err.Error(), "does not belong") {
+		t.Errorf("expected a mismatch error, got %v", err)
+	}
+
+	os.Remove(file + ".pub")
+	if _, _, err := ReadKeyPair(file); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected a missing public key error, got %v", err)
+	}
+
+	ioutil.WriteFile(file, []byte("not a key"), 0600)
+	if _, _, err := ReadKeyPair(file); err == nil || !strings.Contains(err.Error(), "not valid") {
+		t.Errorf("expected an invalid private key error, got %v", err)
+	}
+}
+
+func TestSSHDir(t *testing.T) {
+	for _, tc := range []struct {
+		user, home, want string
+	}{
+		{"docker", "/home/docker\n", "/home/docker/.ssh"},
+		{"root", "/root", "/root/.ssh"},
+		{"core", "/var/home/core", "/var/home/core/.ssh"},
+		{"root", "", "/root/.ssh"},
+		{"docker", "", "/home/docker/.ssh"},
+		{"docker", "$HOME", "/home/docker/.ssh"},
+	} {
+		if got := sshDir(tc.user, tc.home); got != tc.want {
+			t.Errorf("sshDir(%q, %q) = %q, want %q", tc.user, tc.home, got, tc.want)
+		}
+	}
+
+	out, err := exec.Command("sh", "-c", homeDirCommand).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if home := os.Getenv("HOME"); string(out) != home {
+		t.Errorf("homeDirCommand printed %q, want %q", out, home)
+	}
+}
+
+func TestSSHKeyStorePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxmoxve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "test", StorePath: dir}}
+	if got := d.GetSSHKeyPath(); got != dir+"/machines/test/id_rsa" {
+		t.Errorf("expected the key in the machine store, got %q", got)
+	}
+
+	keys := dir + "/keys"
+	d.SSHKeyStorePath = keys
+	if got := d.GetSSHKeyPath(); got != keys+"/id_test" {
+		t.Errorf("expected the key in the key store path, got %q", got)
+	}
+	if err := checkKeyStorePath(keys); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(keys); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("expected the key store path to be created with mode 0700, got %v", info.Mode())
+	}
+
+	if err := os.Chmod(keys, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkKeyStorePath(keys); err == nil || !strings.Contains(err.Error(), "chmod 700") {
+		t.Errorf("expected a key store path readable by others to be rejected, got %v", err)
+	}
+	if err := checkKeyStorePath("keys"); err == nil {
+		t.Error("expected a relative key store path to be rejected")
+	}
+
+	// the key pair is removed with the machine
+	if err := os.Chmod(keys, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKeyPair(d.GetSSHKeyPath(), "pub", "priv"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(keys); len(files) != 0 {
+		t.Errorf("expected the key pair to be removed, found %d files", len(files))
+	}
+}
+
+func TestAuthorizedKeysInstallCommand(t *testing.T) {
+	cmd := authorizedKeysInstallCommand("/home/o'neil/.ssh", true)
+	want := `mkdir -p -m 700 '/home/o'"'"'neil/.ssh' && install -m 600 /dev/stdin '/home/o'"'"'neil/.ssh'/authorized_keys`
+	if cmd != want {
+		t.Errorf("authorizedKeysInstallCommand() = %s, want %s", cmd, want)
+	}
+
+	dir, err := ioutil.TempDir("", "proxmoxve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sh := exec.Command("sh", "-c", authorizedKeysInstallCommand(dir+"/.ssh", true))
+	sh.Stdin = strings.NewReader("ssh-ed25519 AAAA test\n")
+	if out, err := sh.CombinedOutput(); err != nil {
+		t.Fatalf("command failed: %v %s", err, out)
+	}
+	fi, err := os.Stat(dir + "/.ssh/authorized_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("authorized_keys has mode %o, want 600", fi.Mode().Perm())
+	}
+	content, _ := ioutil.ReadFile(dir + "/.ssh/authorized_keys")
+	if string(content) != "ssh-ed25519 AAAA test\n" {
+		t.Errorf("authorized_keys = %q", content)
+	}
+}
+
+func TestAuthorizedKeysAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxmoxve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sshdir := dir + "/.ssh"
+	os.Mkdir(sshdir, 0700)
+	// existing key without a trailing newline and too open permissions
+	ioutil.WriteFile(sshdir+"/authorized_keys", []byte("ssh-rsa AAAA operator"), 0644)
+
+	for i := 0; i < 2; i++ {
+		sh := exec.Command("sh", "-c", authorizedKeysInstallCommand(sshdir, false))
+		sh.Stdin = strings.NewReader("ssh-ed25519 BBBB machine\n")
+		if out, err := sh.CombinedOutput(); err != nil {
+			t.Fatalf("command failed: %v %s", err, out)
+		}
+	}
+
+	content, _ := ioutil.ReadFile(sshdir + "/authorized_keys")
+	if want := "ssh-rsa AAAA operator\nssh-ed25519 BBBB machine\n"; string(content) != want {
+		t.Errorf("authorized_keys = %q, want %q", content, want)
+	}
+	fi, err := os.Stat(sshdir + "/authorized_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("authorized_keys has mode %o, want 600", fi.Mode().Perm())
+	}
+}
+
+func TestProvisionScriptCommand(t *testing.T) {
+	run := func(script string) (string, error) {
+		var lines []string
+		output := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+		sh := exec.Command("sh", "-c", provisionScriptCommand)
+		sh.Stdin = strings.NewReader(script)
+		sh.Stdout = output
+		sh.Stderr = output
+		err := sh.Run()
+		output.Flush()
+		return strings.Join(lines, "|"), err
+	}
+
+	out, err := run("#!/bin/sh\necho installing\nprintf done")
+	if err != nil {
+		t.Fatalf("script failed: %v %s", err, out)
+	}
+	if out != "installing|done" {
+		t.Errorf("output = %q", out)
+	}
+
+	out, err = run("#!/bin/sh\necho broken >&2\nexit 3")
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 3 {
+		t.Errorf("expected the exit status of the script, got %v", err)
+	}
+	if out != "broken" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestWaitForSSHTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	d := newTestDriver(nil)
+	d.StaticIPAddress = "127.0.0.1"
+	d.SSHPort = port
+	d.ProvisionTimeout = 2
+
+	start := time.Now()
+	_, _, err = d.waitForSSH(&ssh.ClientConfig{User: "docker", HostKeyCallback: ssh.InsecureIgnoreHostKey()}, false)
+	if err == nil || !strings.Contains(err.Error(), "did not become reachable within 2s") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("waitForSSH took %s, longer than the provision timeout", elapsed)
+	}
+}
+
+func TestWaitForSSHAuthFailure(t *testing.T) {
+	_, priv, err := GenKeyPair("ed25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.ParsePrivateKey([]byte(priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, fmt.Errorf("wrong password")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				ssh.NewServerConn(conn, config)
+				conn.Close()
+			}()
+		}
+	}()
+
+	d := newTestDriver(nil)
+	d.StaticIPAddress = "127.0.0.1"
+	d.SSHPort = l.Addr().(*net.TCPAddr).Port
+	d.ProvisionTimeout = 10
+	client := &ssh.ClientConfig{
+		User:            "docker",
+		Auth:            []ssh.AuthMethod{ssh.Password("tcuser")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+
+	start := time.Now()
+	_, _, err = d.waitForSSH(client, false)
+	if err == nil || !strings.Contains(err.Error(), "could not log into") {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("rejected credentials were retried for %s", elapsed)
+	}
+
+	d.ProvisionTimeout = 2
+	_, _, err = d.waitForSSH(client, true)
+	if err == nil || !strings.Contains(err.Error(), "did not become reachable within 2s") {
+		t.Errorf("expected rejected credentials to be retried until the timeout, got %v", err)
+	}
+}
+
+// newTestSSHServer accepts the given public key and answers every exec request with
+// the output and exit status of run, it returns the port the server listens on
+func newTestSSHServer(t *testing.T, authorized string, run func(command string) (string, uint32)) (int, func()) {
+	_, hostPriv, err := GenKeyPair("ed25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.ParsePrivateKey([]byte(hostPriv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for newChannel := range chans {
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				req.Reply(true, nil)
+				output, status := run(payload.Command)
+				channel.Write([]byte(output))
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				channel.Close()
+				break
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port, func() { l.Close() }
+}
+
+func TestUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxmoxve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := GenKeyPair("ed25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	var status uint32
+	port, stop := newTestSSHServer(t, pub, func(command string) (string, uint32) {
+		commands = append(commands, command)
+		return "Reading package lists...\n0 upgraded, 0 newly installed\n", status
+	})
+	defer stop()
+
+	d := newTestDriver(nil)
+	d.SSHKeyStorePath = dir
+	if err := writeKeyPair(d.GetSSHKeyPath(), pub, priv); err != nil {
+		t.Fatal(err)
+	}
+	d.StaticIPAddress = "127.0.0.1"
+	d.SSHPort = port
+	d.ProvisionTimeout = 10
+
+	if err := d.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 || commands[0] != pveDefaultUpgradeCommand {
+		t.Errorf("expected the default upgrade command, got %q", commands)
+	}
+
+	d.UpgradeCommand = "sudo -n dnf -y upgrade"
+	status = 1
+	err = d.Upgrade()
+	if err == nil || !strings.Contains(err.Error(), "0 upgraded, 0 newly installed") {
+		t.Errorf("expected the failed upgrade with its last output line, got %v", err)
+	}
+	if len(commands) != 2 || commands[1] != "sudo -n dnf -y upgrade" {
+		t.Errorf("expected the configured upgrade command, got %q", commands)
+	}
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxmoxve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostKey := func() ssh.PublicKey {
+		pub, _, err := GenKeyPair("ed25519", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	first, second := hostKey(), hostKey()
+	addr := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+
+	d := newTestDriver(nil)
+	d.StorePath = dir
+	if err := os.MkdirAll(filepath.Dir(d.ResolveStorePath("known_hosts")), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	d.SSHHostKeyCheck = pveSSHHostKeyIgnore
+	if err := d.hostKeyCallback()("192.0.2.10:22", addr, first); err != nil {
+		t.Errorf("expected any key to be accepted, got %v", err)
+	}
+	if _, err := os.Stat(d.ResolveStorePath("known_hosts")); !os.IsNotExist(err) {
+		t.Errorf("expected no known_hosts without pinning, got %v", err)
+	}
+
+	d.SSHHostKeyCheck = pveSSHHostKeyPin
+	check := d.hostKeyCallback()
+	if err := check("192.0.2.10:22", addr, first); err != nil {
+		t.Fatalf("expected the first key to be pinned, got %v", err)
+	}
+	if err := check("192.0.2.10:22", addr, first); err != nil {
+		t.Errorf("expected the pinned key to be accepted, got %v", err)
+	}
+	err = check("192.0.2.10:22", addr, second)
+	if err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("expected a different key to be rejected, got %v", err)
+	}
+
+	known, err := ioutil.ReadFile(d.ResolveStorePath("known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(known), "\n"); lines != 1 {
+		t.Errorf("expected the key to be recorded once, got %d lines", lines)
+	}
+
+	d.SSHDialTimeout = 0
+	if timeout := d.sshDialTimeout(); timeout != pveDefaultSSHDialTimeout*time.Second {
+		t.Errorf("expected the default dial timeout for machines without one, got %s", timeout)
+	}
+}
+
+func TestBootConfig(t *testing.T) {
+	tests := []struct {
+		bus       string
+		cloudInit bool
+		order     string
+		want      string
+	}{
+		{"scsi", false, "", "order=scsi0;ide2"},
+		{"virtio", true, "", "order=virtio0;ide0"},
+		{"ide", true, "", "order=ide0;ide1"},
+		{"scsi", false, "ide2;scsi0;net0", "order=ide2;scsi0;net0"},
+	}
+	for _, tt := range tests {
+		d := &Driver{DiskBus: tt.bus, CloudInit: tt.cloudInit, BootOrder: tt.order}
+		if got := d.bootConfig(); got != tt.want {
+			t.Errorf("bootConfig() with bus %s, cloud-init %v, order %q = %q, want %q", tt.bus, tt.cloudInit, tt.order, got, tt.want)
+		}
+	}
+
+	form := createVMForm(t, nil)
+	if got := form.Get("boot"); got != "order=scsi0;ide2" {
+		t.Errorf("boot = %q", got)
+	}
+}
+
+func TestEjectISO(t *testing.T) {
+	var form url.Values
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/config":
+			r.ParseForm()
+			form = r.PostForm
+			w.Write([]byte(`{"data":"UPID:pve:1"}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/tasks/UPID:pve:1/status":
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.CloudInit = true
+	d.ProvisionTimeout = 10
+	if err := d.ejectISO(); err != nil {
+		t.Fatal(err)
+	}
+	if len(form) != 1 || form.Get("ide0") != "none,media=cdrom" {
+		t.Errorf("unexpected config update %v", form)
+	}
+}
+
+func TestGrowRootDisk(t *testing.T) {
+	size := "10G"
+	var resizes []url.Values
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/config":
+			fmt.Fprintf(w, `{"data":{"scsi0":"local-lvm:vm-100-disk-0,size=%s"}}`, size)
+		case r.Method == "PUT" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/resize":
+			resizes = append(resizes, r.URL.Query())
+			w.Write([]byte(`{"data":"UPID:pve:1"}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/tasks/UPID:pve:1/status":
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ProvisionTimeout = 10
+	if err := d.growRootDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if len(resizes) != 1 || resizes[0].Get("disk") != "scsi0" || resizes[0].Get("size") != "+6144M" {
+		t.Fatalf("unexpected resizes %v", resizes)
+	}
+
+	// same size, nothing to do
+	size = "16G"
+	resizes = nil
+	if err := d.growRootDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if len(resizes) != 0 {
+		t.Errorf("expected no resize, got %v", resizes)
+	}
+
+	// disks cannot be shrunk
+	size = "32G"
+	if err := d.growRootDisk(); err == nil || !strings.Contains(err.Error(), "cannot be shrunk") {
+		t.Errorf("expected shrink error, got %v", err)
+	}
+	if len(resizes) != 0 {
+		t.Errorf("expected no resize, got %v", resizes)
+	}
+}
+
+func TestCloneConfig(t *testing.T) {
+	d := newTestDriver(nil)
+	d.CloneVMID = "9000"
+	d.KVM = true
+	d.MachineType = pveDefaultVmMachineType
+	d.OsType = pveDefaultVmOsType
+	config, err := d.cloneConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Net0 != "" || config.CPU != "" || config.Numa != "" || config.KVM != "" || config.Machine != "" || config.Ostype != "" {
+		t.Errorf("expected the template settings to be kept with default flags, got %+v", config)
+	}
+
+	d.NetVlanTag = 100
+	d.CpuType = "host"
+	d.Numa = true
+	d.KVM = false
+	d.MachineType = "q35"
+	d.OsType = "l24"
+	config, err = d.cloneConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Net0 != "virtio,bridge=vmbr0,tag=100" {
+		t.Errorf("net0 = %q", config.Net0)
+	}
+	if config.CPU != "host" || config.Numa != "1" || config.KVM != "0" || config.Machine != "q35" || config.Ostype != "l24" {
+		t.Errorf("expected the flags to be applied to the clone, got %+v", config)
+	}
+
+	d.Networks = []string{"model=virtio,bridge=vmbr0", "model=e1000,bridge=vmbr1"}
+	d.NetVlanTag = 0
+	config, err = d.cloneConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Net0 != "model=virtio,bridge=vmbr0" || config.Net1 != "model=e1000,bridge=vmbr1" {
+		t.Errorf("expected the repeated net flags on the clone, got %q and %q", config.Net0, config.Net1)
+	}
+}
+
+func TestCheckCloneFlags(t *testing.T) {
+	d := newTestDriver(nil)
+	d.DiskSSD = true
+	if err := d.checkCloneFlags(); err != nil {
+		t.Errorf("expected disk options without a clone to be accepted, got %v", err)
+	}
+
+	for _, setup := range []func(d *Driver){
+		func(d *Driver) { d.Bios = "ovmf" },
+		func(d *Driver) { d.DiskCache = "writeback" },
+		func(d *Driver) { d.DiskSSD = true },
+		func(d *Driver) { d.DiskDiscard = true },
+		func(d *Driver) { d.DiskIOThread = true },
+		func(d *Driver) { d.ExtraDisks = []string{"size=50G"} },
+	} {
+		d := newTestDriver(nil)
+		d.CloneTemplateName = "debian-12"
+		setup(d)
+		if err := d.checkCloneFlags(); err == nil {
+			t.Errorf("expected the flag to be rejected for a clone, driver %+v", d)
+		}
+	}
+}
+
+func TestQemuDiskDeviceSizeBytes(t *testing.T) {
+	for size, want := range map[string]int64{
+		"16G":        16 << 30,
+		"512M":       512 << 20,
+		"1.5T":       3 << 39,
+		"4194304K":   4 << 30,
+		"1073741824": 1 << 30,
+	} {
+		got, err := QemuDiskDevice{Size: size}.SizeBytes()
+		if err != nil || got != want {
+			t.Errorf("SizeBytes(%s) = %d, %v, want %d", size, got, err, want)
+		}
+	}
+	if _, err := (QemuDiskDevice{Size: "big"}).SizeBytes(); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestCreateVMSerialConsole(t *testing.T) {
+	form := createVMForm(t, nil)
+	if form.Get("vga") != "" || form.Get("serial0") != "" {
+		t.Errorf("vga %q and serial0 %q should be left to Proxmox VE", form.Get("vga"), form.Get("serial0"))
+	}
+
+	form = createVMForm(t, func(d *Driver) {
+		d.Vga = "serial0"
+		d.Serial = true
+	})
+	if form.Get("vga") != "serial0" || form.Get("serial0") != "socket" {
+		t.Errorf("vga = %q, serial0 = %q", form.Get("vga"), form.Get("serial0"))
+	}
+}
+
+func TestCheckImageFile(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/nodes/pve/storage/local/content" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":[
+			{"volid":"local:iso/rancheros.iso","format":"iso","content":"iso","size":123},
+			{"volid":"local:vztmpl/debian.tar.zst","format":"tzst","content":"vztmpl","size":456}
+		]}`))
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ImageFile = "local:iso/rancheros.iso"
+	if err := d.checkImageFile(); err != nil {
+		t.Errorf("expected the image file to be found, got %s", err)
+	}
+
+	d.ImageFile = "local:iso/missing.iso"
+	err := d.checkImageFile()
+	if err == nil || !strings.Contains(err.Error(), "not found on storage 'local'") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	d.ImageFile = "rancheros.iso"
+	if err := d.checkImageFile(); err == nil {
+		t.Error("expected an error for an image file without storage")
+	}
+}
+
+func TestCheckStorageSpace(t *testing.T) {
+	avail := map[string]string{"local-lvm": "21474836480", "ceph": "53687091200"}
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		for storage, bytes := range avail {
+			if r.URL.Path == "/api2/json/nodes/pve/storage/"+storage+"/status" {
+				fmt.Fprintf(w, `{"data":{"type":"lvmthin","total":107374182400,"avail":%s}}`, bytes)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ExtraDisks = []string{"size=512M", "size=50G,storage=ceph"}
+	if err := d.checkStorageSpace(); err != nil {
+		t.Errorf("expected enough space, got %s", err)
+	}
+
+	d.ExtraDisks = []string{"size=5G"}
+	err := d.checkStorageSpace()
+	if err == nil || !strings.Contains(err.Error(), "storage 'local-lvm' has 20.0 GB available, but the disks need 21.0 GB") {
+		t.Errorf("expected an out of space error, got %v", err)
+	}
+
+	// the root disk counts against its own storage
+	d.RootDiskStorage = "ceph"
+	d.ExtraDisks = []string{"size=5G", "size=40G,storage=ceph"}
+	err = d.checkStorageSpace()
+	if err == nil || !strings.Contains(err.Error(), "storage 'ceph' has 50.0 GB available, but the disks need 56.0 GB") {
+		t.Errorf("expected an out of space error for the root disk storage, got %v", err)
+	}
+
+	// the root disk of a clone is not allocated by the driver
+	d.CloneVMID = "9000"
+	if err := d.checkStorageSpace(); err != nil {
+		t.Errorf("expected enough space for a clone, got %s", err)
+	}
+}
+
+func TestCheckStorages(t *testing.T) {
+	lookups := 0
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/nodes/pve/storage" {
+			http.NotFound(w, r)
+			return
+		}
+		lookups++
+		w.Write([]byte(`{"data":[{"storage":"local-lvm","type":"lvmthin"},{"storage":"nvme","type":"zfspool"}]}`))
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.RootDiskStorage = "nvme"
+	d.CloudInitStorage = "local-lvm"
+	if err := d.checkStorages(); err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 2 {
+		t.Errorf("expected each storage to be looked up once, got %d lookups", lookups)
+	}
+
+	d.CloudInit = true
+	d.CloudInitStorage = "missing"
+	err := d.checkStorages()
+	if err == nil || !strings.Contains(err.Error(), "--"+pveCloudInitStorageParameter+": storage 'missing' not found") {
+		t.Errorf("expected the cloud-init storage to be rejected, got %v", err)
+	}
+}
+
+func TestCheckStorageFormat(t *testing.T) {
+	d := &Driver{RootDiskStorage: "local-zfs"}
+	if err := d.checkStorageFormat("zfspool"); err != nil || d.StorageType != "raw" {
+		t.Errorf("expected raw to be picked on zfspool, got %q, %v", d.StorageType, err)
+	}
+
+	d = &Driver{RootDiskStorage: "local"}
+	if err := d.checkStorageFormat("dir"); err != nil || d.StorageType != pveDefaultStorageType {
+		t.Errorf("expected the default type on dir, got %q, %v", d.StorageType, err)
+	}
+
+	d = &Driver{RootDiskStorage: "local", StorageType: "qcow2"}
+	if err := d.checkStorageFormat("dir"); err != nil || d.StorageType != "qcow2" {
+		t.Errorf("expected qcow2 to be kept on dir, got %q, %v", d.StorageType, err)
+	}
+
+	d = &Driver{RootDiskStorage: "ceph-vm", StorageType: "qcow2"}
+	err := d.checkStorageFormat("rbd")
+	if err == nil || !strings.Contains(err.Error(), "does only support raw") {
+		t.Errorf("expected an explicit qcow2 to be rejected on rbd, got %v", err)
+	}
+}
+
+func TestDiskFilename(t *testing.T) {
+	d := &Driver{VMID: "100", StorageType: "qcow2", DiskPreallocation: "falloc"}
+
+	if got := d.diskFilename("dir", 0); got != "vm-100-disk-0.qcow2" {
+		t.Errorf("expected the format as extension on dir, got %q", got)
+	}
+	if got := d.diskPreallocation(d.diskFilename("dir", 1)); got != "falloc" {
+		t.Errorf("expected the preallocation for disk files, got %q", got)
+	}
+
+	d.StorageType = "raw"
+	if got := d.diskFilename("lvmthin", 2); got != "vm-100-disk-2" {
+		t.Errorf("expected no extension on lvmthin, got %q", got)
+	}
+	if got := d.diskPreallocation(d.diskFilename("lvmthin", 2)); got != "" {
+		t.Errorf("expected no preallocation for block volumes, got %q", got)
+	}
+}
+
+func TestCreateVMDiskPreallocation(t *testing.T) {
+	var form url.Values
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/storage/local/content":
+			r.ParseForm()
+			form = r.PostForm
+			w.Write([]byte(`{"data":"local:100/vm-100-disk-0.qcow2"}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu":
+			w.Write([]byte(`{"data":""}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.Storage = "local"
+	d.RootDiskStorage = "local"
+	d.StorageType = "qcow2"
+	d.StorageFilename = d.diskFilename("dir", 0)
+	d.DiskPreallocation = "metadata"
+	if err := d.createVM(); err != nil {
+		t.Fatal(err)
+	}
+	if got := form.Get("filename"); got != "vm-100-disk-0.qcow2" {
+		t.Errorf("filename = %q", got)
+	}
+	if got := form.Get("preallocation"); got != "metadata" {
+		t.Errorf("preallocation = %q", got)
+	}
+}
+
+func TestAllocateVolumeTimeout(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		// the body must be read before the server notices the client going away
+		r.ParseForm()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+		w.Write([]byte(`{"data":"local-lvm:vm-100-disk-0"}`))
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.DiskAllocTimeout = 1
+	d.ProvisionTimeout = 300
+	volume := NodesNodeStorageStorageContentPostParameter{Filename: "vm-100-disk-0", Size: "16G", VMID: "100"}
+	started := time.Now()
+	_, err := d.allocateVolume("local-lvm", &volume)
+	if err == nil || !strings.Contains(err.Error(), "took longer than 1s") {
+		t.Errorf("expected the allocation to time out, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected the allocation to give up after 1s, took %s", elapsed)
+	}
+}
+
+func TestCheckThinProvisioning(t *testing.T) {
+	d := &Driver{RootDiskStorage: "local", StorageType: "qcow2"}
+	if err := d.checkThinProvisioning("dir"); err != nil || d.DiskPreallocation != "metadata" {
+		t.Errorf("expected metadata preallocation for thin qcow2 files, got %q, %v", d.DiskPreallocation, err)
+	}
+
+	d = &Driver{RootDiskStorage: "local", StorageType: "raw"}
+	if err := d.checkThinProvisioning("dir"); err != nil || d.DiskPreallocation != "off" {
+		t.Errorf("expected no preallocation for thin raw files, got %q, %v", d.DiskPreallocation, err)
+	}
+
+	d = &Driver{RootDiskStorage: "local", StorageType: "qcow2", DiskPreallocation: "full"}
+	if err := d.checkThinProvisioning("dir"); err == nil {
+		t.Error("expected full preallocation to conflict with thin disks")
+	}
+
+	d = &Driver{RootDiskStorage: "san", StorageType: "raw"}
+	if err := d.checkThinProvisioning("lvm"); err == nil || !strings.Contains(err.Error(), "does not support thin provisioning") {
+		t.Errorf("expected thick LVM to be rejected, got %v", err)
+	}
+
+	d = &Driver{RootDiskStorage: "local-lvm", StorageType: "raw"}
+	if err := d.checkThinProvisioning("lvmthin"); err != nil || d.DiskPreallocation != "" {
+		t.Errorf("expected lvmthin to be accepted as is, got %q, %v", d.DiskPreallocation, err)
+	}
+}
+
+func TestCreateVMDiskThin(t *testing.T) {
+	var form url.Values
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/storage/local/content":
+			r.ParseForm()
+			form = r.PostForm
+			w.Write([]byte(`{"data":"local:100/vm-100-disk-0.qcow2"}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu":
+			w.Write([]byte(`{"data":""}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.Storage = "local"
+	d.RootDiskStorage = "local"
+	d.StorageType = "qcow2"
+	d.DiskThin = true
+	if err := d.checkThinProvisioning("dir"); err != nil {
+		t.Fatal(err)
+	}
+	d.StorageFilename = d.diskFilename("dir", 0)
+	if err := d.createVM(); err != nil {
+		t.Fatal(err)
+	}
+	if got := form.Get("preallocation"); got != "metadata" {
+		t.Errorf("preallocation = %q", got)
+	}
+	if got := form.Get("size"); got != "16G" {
+		t.Errorf("size = %q", got)
+	}
+}
+
+func TestCheckPool(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/pools" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":[{"poolid":"docker"},{"poolid":"test","comment":"CI machines"}]}`))
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.Pool = "test"
+	if err := d.checkPool(); err != nil {
+		t.Errorf("expected pool 'test' to be found, got %s", err)
+	}
+
+	d.Pool = "tset"
+	err := d.checkPool()
+	if err == nil || !strings.Contains(err.Error(), "available pools: docker, test") {
+		t.Errorf("expected an error listing the pools, got %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var form url.Values
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/snapshot":
+			r.ParseForm()
+			form = r.PostForm
+			w.Write([]byte(`{"data":"UPID:pve:2"}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/tasks/UPID:pve:2/status":
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"snapshot feature is not available"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ProvisionTimeout = 10
+	err := d.SnapshotWithState("pre-upgrade")
+	if err == nil || !strings.Contains(err.Error(), "snapshot feature is not available") {
+		t.Errorf("expected the failed task to be reported, got %v", err)
+	}
+	if form.Get("snapname") != "pre-upgrade" || form.Get("vmstate") != "1" {
+		t.Errorf("unexpected snapshot request %v", form)
+	}
+
+	if err := d.Snapshot("1st"); err == nil {
+		t.Error("expected an error for a snapshot name starting with a digit")
+	}
+}
+
+func TestSuspendResume(t *testing.T) {
+	var requests []string
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/api2/json/nodes/pve/qemu/100/status/"):
+			r.ParseForm()
+			requests = append(requests, strings.TrimPrefix(r.URL.Path, "/api2/json/nodes/pve/qemu/100/status/")+"?"+r.PostForm.Encode())
+			w.Write([]byte(`{"data":"UPID:pve:3"}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/tasks/UPID:pve:3/status":
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/current":
+			w.Write([]byte(`{"data":{"status":"stopped","lock":"suspended"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ProvisionTimeout = 10
+	for _, f := range []func() error{d.Suspend, d.Hibernate, d.Resume} {
+		if err := f(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"suspend?todisk=0", "suspend?todisk=1", "resume?"}
+	if strings.Join(requests, " ") != strings.Join(want, " ") {
+		t.Errorf("unexpected requests %v, want %v", requests, want)
+	}
+
+	st, err := api.NodesNodeQemuVMIDStatusCurrentGet("pve", "100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != state.Saved {
+		t.Errorf("expected a VM suspended to disk to be saved, got %s", st)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var requests []string
+	status := "running"
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/api2/json/nodes/pve/qemu/100"))
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/current":
+			fmt.Fprintf(w, `{"data":{"status":"%s"}}`, status)
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/shutdown":
+			status = "stopped"
+			w.Write([]byte(`{"data":"UPID:pve:4"}`))
+		case r.Method == "DELETE" && r.URL.Path == "/api2/json/nodes/pve/qemu/100":
+			if r.URL.Query().Get("purge") != "1" || r.URL.Query().Get("destroy-unreferenced-disks") != "1" {
+				t.Errorf("unexpected destroy parameters '%s'", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"data":"UPID:pve:5"}`))
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/api2/json/nodes/pve/tasks/"):
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ProvisionTimeout = 10
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	want := "GET /status/current GET /status/current POST /status/shutdown GET /api2/json/nodes/pve/tasks/UPID:pve:4/status GET /status/current DELETE  GET /api2/json/nodes/pve/tasks/UPID:pve:5/status"
+	if got := strings.Join(requests, " "); got != want {
+		t.Errorf("unexpected requests\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestStopTaskFailed(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/current":
+			w.Write([]byte(`{"data":{"status":"running"}}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/shutdown":
+			w.Write([]byte(`{"data":"UPID:pve:4"}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/tasks/UPID:pve:4/status":
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"VM quit/powerdown failed"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	err := d.stop(10)
+	if err == nil || !strings.Contains(err.Error(), "VM quit/powerdown failed") {
+		t.Errorf("expected the failed shutdown task, got %v", err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	var requests []string
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/api2/json/nodes/pve/"))
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/current":
+			w.Write([]byte(`{"data":{"status":"running"}}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/reboot":
+			w.Write([]byte(`{"data":"UPID:pve:6"}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/tasks/UPID:pve:6/status":
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/agent":
+			w.Write([]byte(`{"data":{}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.NoAgent = false
+	if err := d.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	want := "GET qemu/100/status/current POST qemu/100/status/reboot GET tasks/UPID:pve:6/status POST qemu/100/agent"
+	if got := strings.Join(requests, " "); got != want {
+		t.Errorf("unexpected requests\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRemoveMissingVM(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	if err := d.Remove(); err != nil {
+		t.Errorf("expected removing a missing VM to succeed, got %s", err)
+	}
+
+	if !notFound(&apiError{code: 500, status: "500 Configuration file 'nodes/pve/qemu-server/100.conf' does not exist"}) {
+		t.Error("expected a missing configuration file to be reported as not found")
+	}
+	if notFound(&apiError{code: 500, status: "500 VM is locked (backup)"}) {
+		t.Error("expected a locked VM not to be reported as not found")
+	}
+}
+
+func TestStart(t *testing.T) {
+	exitstatus := "OK"
+	polls := 0
+	statusFails := false
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/start":
+			w.Write([]byte(`{"data":"UPID:pve:6"}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/tasks/UPID:pve:6/status":
+			fmt.Fprintf(w, `{"data":{"status":"stopped","exitstatus":"%s"}}`, exitstatus)
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/current" && statusFails:
+			http.Error(w, "", http.StatusForbidden)
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/current":
+			polls++
+			if polls < 2 {
+				w.Write([]byte(`{"data":{"status":"stopped"}}`))
+			} else {
+				w.Write([]byte(`{"data":{"status":"running","qmpstatus":"running"}}`))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.ProvisionTimeout = 10
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 2 {
+		t.Errorf("expected the state to be polled until running, got %d polls", polls)
+	}
+
+	exitstatus = "TASK ERROR: KVM virtualisation configured, but not available"
+	err := d.Start()
+	if err == nil || !strings.Contains(err.Error(), "could not start VM '100'") || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("expected the start task error, got %v", err)
+	}
+
+	// the wait is bounded by the provision timeout and reports why the status was unknown
+	exitstatus = "OK"
+	statusFails = true
+	d.ProvisionTimeout = 1
+	err = d.Start()
+	if err == nil || !strings.Contains(err.Error(), "1s after it was started, last status error") {
+		t.Errorf("expected the status error after the timeout, got %v", err)
+	}
+}
+
+func TestWaitForTaskLog(t *testing.T) {
+	var query url.Values
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api2/json/nodes/pve/tasks/UPID:pve:7/status":
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"unable to create VM 100 - command failed"}}`))
+		case "/api2/json/nodes/pve/tasks/UPID:pve:7/log":
+			query = r.URL.Query()
+			w.Write([]byte(`{"data":[
+				{"n":1,"t":"  Logical volume \"vm-100-disk-0\" created."},
+				{"n":2,"t":""},
+				{"n":3,"t":"  Volume group \"pve\" has insufficient free space (1023 extents): 4096 required."},
+				{"n":4,"t":"TASK ERROR: unable to create VM 100 - command failed"}
+			],"total":4}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	err := api.WaitForTask("pve", "UPID:pve:7", 10*time.Second)
+	want := "task 'UPID:pve:7' failed: unable to create VM 100 - command failed, task log:\n" +
+		"Logical volume \"vm-100-disk-0\" created.\n" +
+		"Volume group \"pve\" has insufficient free space (1023 extents): 4096 required."
+	if err == nil || err.Error() != want {
+		t.Errorf("WaitForTask() = %v, want %q", err, want)
+	}
+	if query.Get("limit") != "500" {
+		t.Errorf("unexpected log query %v", query)
+	}
+
+	lines, err := api.taskLogTail("pve", "UPID:pve:7")
+	if err != nil || len(lines) != 2 {
+		t.Errorf("taskLogTail() = %q, %v", lines, err)
+	}
+}
+
+func TestTaskLogTailLongLog(t *testing.T) {
+	const total = 1234
+	var starts []string
+	failed := false
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/nodes/pve/tasks/UPID:pve:8/log" {
+			http.NotFound(w, r)
+			return
+		}
+		// a loaded cluster fails the first read, the log is read anyway
+		if !failed {
+			failed = true
+			w.WriteHeader(596)
+			return
+		}
+		query := r.URL.Query()
+		starts = append(starts, query.Get("start"))
+		start, _ := strconv.Atoi(query.Get("start"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		entries := []string{}
+		for n := start + 1; n <= start+limit && n <= total; n++ {
+			line := fmt.Sprintf("transferred %d MiB", n)
+			if n == total {
+				line = "TASK ERROR: clone failed: copy failed"
+			}
+			entries = append(entries, fmt.Sprintf(`{"n":%d,"t":"%s"}`, n, line))
+		}
+		fmt.Fprintf(w, `{"data":[%s],"total":%d}`, strings.Join(entries, ","), total)
+	})
+	defer server.Close()
+	api.Retries = 3
+
+	lines, err := api.taskLogTail("pve", "UPID:pve:8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "transferred 1229 MiB transferred 1230 MiB transferred 1231 MiB transferred 1232 MiB transferred 1233 MiB"
+	if got := strings.Join(lines, " "); got != want {
+		t.Errorf("taskLogTail() = %q, want %q", got, want)
+	}
+	if strings.Join(starts, " ") != "0 734" {
+		t.Errorf("unexpected log pages starting at %v", starts)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/nodes/pve/qemu/100/agent" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("command") == "ping" {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Second):
+			}
+		}
+		w.Write([]byte(`{"data":{}}`))
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.AgentPingTimeout = 1
+	started := time.Now()
+	if d.ping() {
+		t.Error("expected a hanging guest agent not to answer the ping")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected the ping to give up after 1s, took %s", elapsed)
+	}
+
+	d.AgentPingTimeout = 0
+	if timeout := d.agentPingTimeout(); timeout != pveDefaultAgentPingTimeout*time.Second {
+		t.Errorf("expected the default timeout for machines without one, got %s", timeout)
+	}
+}
+
+func TestFindExistingVM(t *testing.T) {
+	vms := `[{"vmid":105,"name":"test","status":"stopped"}]`
+	description := "Created by docker-machine: test\n"
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api2/json/nodes/pve/qemu":
+			fmt.Fprintf(w, `{"data":%s}`, vms)
+		case "/api2/json/nodes/pve/qemu/105/config":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"name": "test", "description": description}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	if err := d.findExistingVM(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.adopted || d.VMID != "105" {
+		t.Errorf("expected VM 105 to be adopted, got adopted %v with VMID %s", d.adopted, d.VMID)
+	}
+
+	description = "production database"
+	d = newTestDriver(api)
+	err := d.findExistingVM()
+	if err == nil || !strings.Contains(err.Error(), "not created for machine 'test'") || d.adopted {
+		t.Errorf("expected a foreign VM not to be adopted, got %v", err)
+	}
+
+	vms = `[{"vmid":101,"name":"other","status":"running"}]`
+	d = newTestDriver(api)
+	if err := d.findExistingVM(); err != nil || d.adopted || d.VMID != "100" {
+		t.Errorf("expected nothing to be adopted, got adopted %v with VMID %s, %v", d.adopted, d.VMID, err)
+	}
+}
+
+func TestReserveVMID(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api2/json/cluster/resources":
+			w.Write([]byte(`{"data":[{"id":"qemu/100","type":"qemu","node":"pve","vmid":100},{"id":"lxc/4200","type":"lxc","node":"pve","vmid":4200}]}`))
+		case "/api2/json/cluster/nextid":
+			w.Write([]byte(`{"data":"101"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.VMID = ""
+	if err := d.reserveVMID(); err != nil || d.VMID != "101" {
+		t.Errorf("expected the next free VMID, got %q, %v", d.VMID, err)
+	}
+
+	d.RequestedVMID = "4201"
+	if err := d.reserveVMID(); err != nil || d.VMID != "4201" {
+		t.Errorf("expected the requested VMID, got %q, %v", d.VMID, err)
+	}
+
+	d.RequestedVMID = "4200"
+	err := d.reserveVMID()
+	if err == nil || !strings.Contains(err.Error(), "VMID 4200 is already in use") {
+		t.Errorf("expected a VMID used by a container to be rejected, got %v", err)
+	}
+}
+
+func TestNextFreeVMID(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api2/json/cluster/resources":
+			w.Write([]byte(`{"data":[{"id":"qemu/9000","type":"qemu","vmid":9000},{"id":"qemu/9001","type":"qemu","vmid":9001}]}`))
+		case "/api2/json/cluster/nextid":
+			vmid := r.URL.Query().Get("vmid")
+			if vmid == "9002" {
+				// being created by someone else, not yet listed as resource
+				http.Error(w, `{"errors":{"vmid":"VM 9002 already exists"},"data":null}`, http.StatusBadRequest)
+				return
+			}
+			if vmid == "9005" {
+				http.Error(w, `{"errors":{"vmid":"value must have a minimum value of 100"},"data":null}`, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"data":"%s"}`, vmid)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.VMIDRangeMin = 9000
+	if err := d.reserveVMID(); err != nil || d.VMID != "9003" {
+		t.Errorf("expected the first free VMID above 9000, got %q, %v", d.VMID, err)
+	}
+
+	// any other parameter error must not walk through all IDs
+	if vmid, err := d.nextFreeVMID(9005); err == nil {
+		t.Errorf("expected the parameter error to be returned, got VMID %q", vmid)
+	}
+
+	if _, err := d.nextFreeVMID(pveMaxVMID + 1); err == nil {
+		t.Error("expected an error above the highest VMID")
+	}
+}
+
+func TestCheckHAGroup(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api2/json/cluster/ha/groups" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":[{"group":"docker","nodes":"pve1:2,pve2"}]}`))
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.HAGroup = "docker"
+	if err := d.checkHAGroup(); err != nil {
+		t.Errorf("expected HA group 'docker' to be found, got %s", err)
+	}
+	d.HAGroup = "dokcer"
+	if err := d.checkHAGroup(); err == nil {
+		t.Error("expected an error for an unknown HA group")
+	}
+}
+
+func TestRemoveHAResource(t *testing.T) {
+	var requests []string
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/current":
+			w.Write([]byte(`{"data":{"status":"stopped"}}`))
+		case r.Method == "DELETE" && r.URL.Path == "/api2/json/cluster/ha/resources/vm:100":
+			w.Write([]byte(`{"data":null}`))
+		case r.Method == "DELETE" && r.URL.Path == "/api2/json/nodes/pve/qemu/100":
+			w.Write([]byte(`{"data":""}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.HAGroup = "docker"
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	want := "GET /api2/json/nodes/pve/qemu/100/status/current DELETE /api2/json/cluster/ha/resources/vm:100 DELETE /api2/json/nodes/pve/qemu/100"
+	if got := strings.Join(requests, " "); got != want {
+		t.Errorf("unexpected requests\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMigrateTo(t *testing.T) {
+	var form url.Values
+	localDisks := `[{"volid":"local-lvm:vm-100-disk-0","size":17179869184}]`
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/migrate":
+			fmt.Fprintf(w, `{"data":{"running":1,"local_disks":%s,"local_resources":[]}}`, localDisks)
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/status/current":
+			w.Write([]byte(`{"data":{"status":"running","qmpstatus":"running"}}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu/100/migrate":
+			r.ParseForm()
+			form = r.PostForm
+			w.Write([]byte(`{"data":"UPID:pve:7"}`))
+		case r.Method == "GET" && r.URL.Path == "/api2/json/nodes/pve/tasks/UPID:pve:7/status":
+			w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	err := d.MigrateTo("pve2")
+	if err == nil || !strings.Contains(err.Error(), "'local-lvm:vm-100-disk-0' is not on shared storage") {
+		t.Errorf("expected an error for a local disk, got %v", err)
+	}
+
+	localDisks = "[]"
+	if err := d.MigrateTo("pve2"); err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("target") != "pve2" || form.Get("online") != "1" {
+		t.Errorf("unexpected migration request %v", form)
+	}
+	if d.Node != "pve2" {
+		t.Errorf("expected the node to be updated to pve2, got %s", d.Node)
+	}
+}
+
+func TestHostPCIRegexp(t *testing.T) {
+	for _, dev := range []string{"0000:01:00", "01:00.0", "0000:01:00,pcie=1,x-vga=1", "host=0000:01:00.0;0000:01:00.1", "mapping=gpu,pcie=1"} {
+		if !pveHostPCIRegexp.MatchString(dev) {
+			t.Errorf("PCI device %q should be valid", dev)
+		}
+	}
+	for _, dev := range []string{"", "01", "0000:01:00.8", "0000:01:00,pcie", "gpu"} {
+		if pveHostPCIRegexp.MatchString(dev) {
+			t.Errorf("PCI device %q should be invalid", dev)
+		}
+	}
+}
+
+func TestCreateVMHostPCI(t *testing.T) {
+	form := createVMForm(t, func(d *Driver) {
+		d.MachineType = "q35"
+		d.HostPCI = []string{"0000:01:00,pcie=1,x-vga=1", "0000:02:00"}
+	})
+	if form.Get("hostpci0") != "0000:01:00,pcie=1,x-vga=1" || form.Get("hostpci1") != "0000:02:00" {
+		t.Errorf("hostpci0 = %q, hostpci1 = %q", form.Get("hostpci0"), form.Get("hostpci1"))
+	}
+}
+
+func TestUSBRegexp(t *testing.T) {
+	for _, dev := range []string{"host=1234:5678", "host=1-2", "host=1-2.3,usb3=1", "mapping=dongle"} {
+		if !pveUSBRegexp.MatchString(dev) {
+			t.Errorf("USB device %q should be valid", dev)
+		}
+	}
+	for _, dev := range []string{"", "1234:5678", "host=123:5678", "host=1", "host=1-2,usb3=yes"} {
+		if pveUSBRegexp.MatchString(dev) {
+			t.Errorf("USB device %q should be invalid", dev)
+		}
+	}
+}
+
+func TestCreateVMUSB(t *testing.T) {
+	form := createVMForm(t, func(d *Driver) { d.USB = []string{"host=1234:5678", "host=1-2,usb3=1"} })
+	if form.Get("usb0") != "host=1234:5678" || form.Get("usb1") != "host=1-2,usb3=1" {
+		t.Errorf("usb0 = %q, usb1 = %q", form.Get("usb0"), form.Get("usb1"))
+	}
+}
+
+func TestCreateVMDiskIOThread(t *testing.T) {
+	form := createVMForm(t, nil)
+	if got := form.Get("scsihw"); got != "virtio-scsi-pci" {
+		t.Errorf("scsihw = %q, want virtio-scsi-pci by default", got)
+	}
+
+	form = createVMForm(t, func(d *Driver) { d.DiskIOThread = true })
+	if got := form.Get("scsi0"); !strings.HasSuffix(got, ",iothread=1") {
+		t.Errorf("scsi0 = %q, want an IO thread", got)
+	}
+	if got := form.Get("scsihw"); got != "virtio-scsi-single" {
+		t.Errorf("scsihw = %q, want virtio-scsi-single", got)
+	}
+}
+
+func TestCreateVMInlineDisk(t *testing.T) {
+	var form url.Values
+	allocations := 0
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/storage/local/content":
+			allocations++
+			w.Write([]byte(`{"data":"local:100/vm-100-disk-0.qcow2"}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu":
+			r.ParseForm()
+			form = r.PostForm
+			w.Write([]byte(`{"data":""}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.RootDiskStorage = "local"
+	d.StorageType = "qcow2"
+	d.DiskDiscard = true
+	d.InlineDisk = true
+	if err := d.createVM(); err != nil {
+		t.Fatal(err)
+	}
+	if allocations != 0 {
+		t.Errorf("expected no separate volume allocation, got %d", allocations)
+	}
+	if got := form.Get("scsi0"); got != "local:16,format=qcow2,discard=on" {
+		t.Errorf("scsi0 = %q", got)
+	}
+}
+
+func TestCreateNoStart(t *testing.T) {
+	var requests []string
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/storage/local-lvm/content":
+			w.Write([]byte(`{"data":"local-lvm:vm-100-disk-0"}`))
+		case r.Method == "POST" && r.URL.Path == "/api2/json/nodes/pve/qemu":
+			w.Write([]byte(`{"data":""}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.NoStart = true
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	want := "POST /api2/json/nodes/pve/storage/local-lvm/content POST /api2/json/nodes/pve/qemu"
+	if got := strings.Join(requests, " "); got != want {
+		t.Errorf("requests = %q, want %q", got, want)
+	}
+	if !d.ProvisionPending {
+		t.Error("expected the provisioning to be deferred to the first start")
+	}
+	if got := d.haState(); got != "stopped" {
+		t.Errorf("HA state = %q, want stopped", got)
+	}
+}
+
+func TestCreateVMQemuArgs(t *testing.T) {
+	form := createVMForm(t, func(d *Driver) { d.QemuArgs = "-cpu host,+invtsc" })
+	if got := form.Get("args"); got != "-cpu host,+invtsc" {
+		t.Errorf("args = %q", got)
+	}
+	if _, ok := createVMForm(t, nil)["args"]; ok {
+		t.Error("expected no args by default")
+	}
+}
+
+func TestCreateVMVersionDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		version   string
+		scsihw    string
+		ciupgrade string
+	}{
+		{"7.4-17", "virtio-scsi-pci", ""},
+		{"8.0.4", "virtio-scsi-single", ""},
+		{"8.1.4", "virtio-scsi-single", "0"},
+	} {
+		form := createVMForm(t, func(d *Driver) {
+			d.driver.Version = tc.version
+		})
+		if got := form.Get("scsihw"); got != tc.scsihw {
+			t.Errorf("scsihw = %q on %s, want %q", got, tc.version, tc.scsihw)
+		}
+
+		d := newTestDriver(&ProxmoxVE{Version: tc.version})
+		if got := d.ciUpgrade(); got != tc.ciupgrade {
+			t.Errorf("ciupgrade = %q on %s, want %q", got, tc.version, tc.ciupgrade)
+		}
+	}
+
+	// an extra disk on scsi needs the controller even if the root disk is not on scsi
+	if !hasSCSIDevice(map[string]string{"virtio0": "local-lvm:vm-100-disk-0", "scsi1": "local-lvm:vm-100-disk-1"}) {
+		t.Error("expected scsi1 to need a SCSI controller")
+	}
+	form := createVMForm(t, func(d *Driver) { d.DiskBus = "virtio" })
+	if got := form.Get("scsihw"); got != "" {
+		t.Errorf("scsihw = %q, want none without scsi devices", got)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for version, want := range map[string][2]int{"8.1.4": {8, 1}, "7.4-17": {7, 4}, "6": {6, 0}, "": {0, 0}, "unknown": {0, 0}} {
+		if major, minor := parseVersion(version); major != want[0] || minor != want[1] {
+			t.Errorf("parseVersion(%q) = %d.%d, want %d.%d", version, major, minor, want[0], want[1])
+		}
+	}
+}
+
+func TestGetCapabilities(t *testing.T) {
+	for version, want := range map[string]Capabilities{
+		"7.4-3": {Major: 7, Minor: 4, Q35: true, CloudInitDrive: true, CgroupV2: true, Tags: true, AgentFreezeFs: true},
+		"8.0-2": {Major: 8, Minor: 0, Q35: true, CloudInitDrive: true, CgroupV2: true, Tags: true, AgentFreezeFs: true,
+			SCSISingle: true},
+		"8.1-1": {Major: 8, Minor: 1, Q35: true, CloudInitDrive: true, CgroupV2: true, Tags: true, AgentFreezeFs: true,
+			SCSISingle: true, CIUpgrade: true},
+		"7.3-6":  {Major: 7, Minor: 3, Q35: true, CloudInitDrive: true, CgroupV2: true, Tags: true},
+		"6.4-13": {Major: 6, Minor: 4, Q35: true, CloudInitDrive: true},
+		"5.1-46": {Major: 5, Minor: 1, Q35: true},
+		"":       {},
+	} {
+		if got := (&ProxmoxVE{Version: version}).GetCapabilities(); got != want {
+			t.Errorf("GetCapabilities() on %q = %+v, want %+v", version, got, want)
+		}
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	d := newTestDriver(nil)
+	d.CloudInit = true
+	d.HostPCI = []string{"0000:01:00,pcie=1"}
+	for _, version := range []string{"8.1-1", "6.4-13", ""} {
+		if err := d.checkCapabilities((&ProxmoxVE{Version: version}).GetCapabilities()); err != nil {
+			t.Errorf("expected cloud-init and PCI passthrough on %q, got %v", version, err)
+		}
+	}
+
+	err := d.checkCapabilities((&ProxmoxVE{Version: "5.1-46"}).GetCapabilities())
+	if err == nil || !strings.Contains(err.Error(), pveCloudInitParameter) {
+		t.Errorf("expected cloud-init to be rejected on 5.1, got %v", err)
+	}
+	d.CloudInit = false
+	err = d.checkCapabilities((&ProxmoxVE{Version: "3.4-11"}).GetCapabilities())
+	if err == nil || !strings.Contains(err.Error(), pveHostPCIParameter) {
+		t.Errorf("expected PCI passthrough to be rejected on 3.4, got %v", err)
+	}
+
+	d.HostPCI = nil
+	d.Tags = []string{"docker"}
+	if err := d.checkCapabilities((&ProxmoxVE{Version: "7.0-8"}).GetCapabilities()); err != nil {
+		t.Errorf("expected tags on 7.0, got %v", err)
+	}
+	err = d.checkCapabilities((&ProxmoxVE{Version: "6.4-13"}).GetCapabilities())
+	if err == nil || !strings.Contains(err.Error(), pveTagParameter) {
+		t.Errorf("expected tags to be rejected on 6.4, got %v", err)
+	}
+
+	d.Tags = nil
+	d.NoAgent = false
+	d.AgentFreezeFs = true
+	if err := d.checkCapabilities((&ProxmoxVE{Version: "6.4-13"}).GetCapabilities()); err != nil {
+		t.Errorf("expected the agent with default options on 6.4, got %v", err)
+	}
+	d.AgentFreezeFs = false
+	if err := d.checkCapabilities((&ProxmoxVE{Version: "7.4-3"}).GetCapabilities()); err != nil {
+		t.Errorf("expected freeze-fs-on-backup to be turned off on 7.4, got %v", err)
+	}
+	err = d.checkCapabilities((&ProxmoxVE{Version: "7.3-6"}).GetCapabilities())
+	if err == nil || !strings.Contains(err.Error(), pveAgentFreezeFsParameter) {
+		t.Errorf("expected turning off freeze-fs-on-backup to be rejected on 7.3, got %v", err)
+	}
+}
+
+func TestGetSSHKeyFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxmoxve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := NewDriver("test", dir).(*Driver)
+	if err := os.MkdirAll(filepath.Dir(d.GetSSHKeyPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := GetKeyPair(d.GetSSHKeyPath(), "ed25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(d.GetSSHKeyPath(), dir) {
+		t.Errorf("key path '%s' is not in the machine directory '%s'", d.GetSSHKeyPath(), dir)
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := d.GetSSHKeyFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprint != ssh.FingerprintSHA256(key) {
+		t.Errorf("fingerprint = %s, want %s", fingerprint, ssh.FingerprintSHA256(key))
+	}
+}
+
+func TestCreateVMDryRun(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("unexpected %s request to '%s' in a dry run", r.Method, r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/api2/json/nodes/pve/storage":
+			w.Write([]byte(`{"data":[{"storage":"local-lvm","type":"lvmthin"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer server.Close()
+
+	d := newTestDriver(api)
+	d.DryRun = true
+	d.ExtraDisks = []string{"size=50G"}
+	if err := d.createVM(); err != errDryRun {
+		t.Errorf("expected the dry run to stop createVM, got %v", err)
+	}
+}
+
+func TestRemoveDryRun(t *testing.T) {
+	api, server := newTestAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected %s request to '%s' for a dry run machine", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+	})
+	defer server.Close()
+
+	// the VM of an earlier create was adopted by PreCreateCheck
+	d := newTestDriver(api)
+	d.DryRun = true
+	d.adopted = true
+	if err := d.Create(); err != errDryRun {
+		t.Fatalf("expected the dry run to stop Create, got %v", err)
+	}
+	if d.VMID != "" || d.adopted {
+		t.Errorf("expected the dry run to forget VM '%s'", d.VMID)
+	}
+
+	// the configuration may have been saved with the VMID before Create
+	d.VMID = "100"
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+}